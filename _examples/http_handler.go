@@ -20,66 +20,69 @@ func main() {
 }
 
 func exampleHandler() handleFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		exp := experiment.New[string](
-			experiment.WithPercentage(50),
-			experiment.WithConcurrency(),
-			experiment.WithTimeout(500*time.Millisecond),
-		).WithPublisher(&experiment.LogPublisher[string]{})
-
-		exp.Before(func(context.Context) error {
-			fmt.Println("before")
-			return nil
-		})
+	// the experiment is defined once and run for every request with the name
+	// from the query as input.
+	def := experiment.NewDefinition[string, string](
+		experiment.WithPercentage(50),
+		experiment.WithConcurrency(),
+		experiment.WithTimeout(500*time.Millisecond),
+	).WithPublisher(&experiment.LogPublisher[string]{})
 
-		exp.Control(func(context.Context) (string, error) {
-			return fmt.Sprintf("Hello %s", r.URL.Query().Get("name")), nil
-		})
+	def.Before(func(context.Context, string) error {
+		fmt.Println("before")
+		return nil
+	})
 
-		exp.Candidate("foo", func(context.Context) (string, error) {
-			fmt.Println("foo")
-			return "Hello foo", nil
-		})
+	def.Control(func(_ context.Context, name string) (string, error) {
+		return fmt.Sprintf("Hello %s", name), nil
+	})
 
-		exp.Candidate("bar", func(context.Context) (string, error) {
-			fmt.Println("bar")
-			return "Hello bar", nil
-		})
+	def.Candidate("foo", func(context.Context, string) (string, error) {
+		fmt.Println("foo")
+		return "Hello foo", nil
+	})
 
-		exp.Candidate("baz", func(context.Context) (string, error) {
-			return "", errors.New("bar")
-		})
+	def.Candidate("bar", func(context.Context, string) (string, error) {
+		fmt.Println("bar")
+		return "Hello bar", nil
+	})
 
-		exp.Candidate("timeout", func(ctx context.Context) (string, error) {
-			select {
-			case <-time.Tick(time.Second):
-				return "Waited a full second!", nil
-			case <-ctx.Done():
-				return "Timeout hit", ctx.Err()
-			}
-		})
+	def.Candidate("baz", func(context.Context, string) (string, error) {
+		return "", errors.New("bar")
+	})
 
-		exp.Compare(func(control, candidate string) bool {
-			fmt.Printf("Comparing '%s' with '%s'\n", control, candidate)
-			return control == candidate
-		})
+	def.Candidate("timeout", func(ctx context.Context, _ string) (string, error) {
+		select {
+		case <-time.Tick(time.Second):
+			return "Waited a full second!", nil
+		case <-ctx.Done():
+			return "Timeout hit", ctx.Err()
+		}
+	})
 
-		exp.Clean(func(c string) string {
-			fmt.Println("cleanup")
-			return c
-		})
+	def.Compare(func(control, candidate string) bool {
+		fmt.Printf("Comparing '%s' with '%s'\n", control, candidate)
+		return control == candidate
+	})
 
-		exp.Force(r.URL.Query().Get("force") == "true")
-		exp.Ignore(r.URL.Query().Get("ignore") == "true")
+	def.Clean(func(c string) string {
+		fmt.Println("cleanup")
+		return c
+	})
 
-		ctx := context.Background()
-		result, err := exp.Run(ctx)
-		_ = exp.Publish(ctx)
-		if err != nil {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// with concurrency enabled, the observations are published in the
+		// background once all candidates have finished.
+		query := r.URL.Query()
+		result := def.Run(context.Background(), query.Get("name"),
+			experiment.WithRunForce(query.Get("force") == "true"),
+			experiment.WithRunIgnore(query.Get("ignore") == "true"),
+		)
+		if result.Error != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
+			w.Write([]byte(result.Error.Error()))
 		} else {
-			w.Write([]byte(result))
+			w.Write([]byte(result.Value))
 		}
 	}
 }
@@ -0,0 +1,258 @@
+package experiment
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// BreakerState represents the state of the circuit breaker of a candidate.
+type BreakerState int
+
+const (
+	// BreakerClosed means the candidate runs as usual.
+	BreakerClosed BreakerState = iota
+
+	// BreakerOpen means the candidate is skipped until the cool-down period
+	// has passed.
+	BreakerOpen
+
+	// BreakerHalfOpen means a single run of the candidate is let through to
+	// probe whether it has recovered.
+	BreakerHalfOpen
+)
+
+// String returns the name of the state.
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerEvent represents a state transition of the circuit breaker of a
+// candidate.
+type BreakerEvent struct {
+	Experiment string
+	Candidate  string
+	From       BreakerState
+	To         BreakerState
+}
+
+// BreakerPublisher can be implemented by a Publisher to be notified of state
+// transitions of the circuit breaker. The events are published together with
+// the observations of the run in which the transition happened.
+type BreakerPublisher interface {
+	PublishBreakerEvent(context.Context, BreakerEvent) error
+}
+
+// BreakerConfig represents the configuration of a CircuitBreaker. A candidate
+// fails when it returns an error, panics or times out. The breaker trips
+// when either of the configured thresholds is reached within the window.
+type BreakerConfig struct {
+	// ConsecutiveFailures trips the breaker after this amount of failures in
+	// a row. Zero disables this threshold.
+	ConsecutiveFailures int
+
+	// FailureRatio trips the breaker when this ratio of the runs fails, once
+	// at least MinRuns runs have been recorded. Zero disables this threshold.
+	FailureRatio float64
+	MinRuns      int
+
+	// Window is the period in which failures are counted. It defaults to a
+	// minute.
+	Window time.Duration
+
+	// CoolDown is the period for which a tripped candidate is skipped before
+	// it is probed again. It defaults to 30 seconds.
+	CoolDown time.Duration
+}
+
+// NewCircuitBreaker returns a new CircuitBreaker with the given configuration.
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.Window <= 0 {
+		cfg.Window = time.Minute
+	}
+
+	if cfg.CoolDown <= 0 {
+		cfg.CoolDown = 30 * time.Second
+	}
+
+	return &CircuitBreaker{
+		config:   cfg,
+		breakers: map[breakerKey]*breaker{},
+	}
+}
+
+// CircuitBreaker keeps track of failing candidates and skips them once they
+// fail too often. It keeps state per experiment name and candidate name, so it
+// should be created once and shared by all runs of the experiments it is used
+// for. It is safe for concurrent use.
+type CircuitBreaker struct {
+	config BreakerConfig
+
+	mu       sync.Mutex
+	breakers map[breakerKey]*breaker
+}
+
+type breakerKey struct {
+	experiment string
+	candidate  string
+}
+
+type breaker struct {
+	state       BreakerState
+	since       time.Time
+	generation  uint64
+	probing     bool
+	runs        int
+	failures    int
+	consecutive int
+}
+
+// State returns the current state of the breaker for the given candidate.
+func (cb *CircuitBreaker) State(experiment, candidate string) BreakerState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if b, ok := cb.breakers[breakerKey{experiment, candidate}]; ok {
+		return b.state
+	}
+
+	return BreakerClosed
+}
+
+func (cb *CircuitBreaker) get(key breakerKey) *breaker {
+	b, ok := cb.breakers[key]
+	if !ok {
+		b = &breaker{since: time.Now()}
+		cb.breakers[key] = b
+	}
+
+	return b
+}
+
+// breakerTicket identifies a run of a candidate which was allowed through the
+// breaker. Its outcome only counts towards the state it was allowed in.
+type breakerTicket struct {
+	generation uint64
+	probe      bool
+}
+
+// allow reports whether the candidate may run. When the cool-down period of an
+// open breaker has passed, it lets a single probe through and returns the
+// transition to half-open. The ticket must be passed to record.
+func (cb *CircuitBreaker) allow(experiment, candidate string) (breakerTicket, bool, *BreakerEvent) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(breakerKey{experiment, candidate})
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.since) < cb.config.CoolDown {
+			return breakerTicket{}, false, nil
+		}
+
+		b.probing = true
+		event := cb.transition(experiment, candidate, b, BreakerHalfOpen)
+		return breakerTicket{generation: b.generation, probe: true}, true, event
+	case BreakerHalfOpen:
+		if b.probing {
+			return breakerTicket{}, false, nil
+		}
+
+		b.probing = true
+		return breakerTicket{generation: b.generation, probe: true}, true, nil
+	default:
+		return breakerTicket{generation: b.generation}, true, nil
+	}
+}
+
+// record records the outcome of a candidate which was allowed to run and
+// returns the transition it caused, if any. Outcomes of runs which were
+// allowed before the last transition are ignored, so a slow run which started
+// while the breaker was closed can't decide the outcome of the probe.
+func (cb *CircuitBreaker) record(experiment, candidate string, ticket breakerTicket, skipped, failed bool) *BreakerEvent {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	b := cb.get(breakerKey{experiment, candidate})
+	if ticket.generation != b.generation {
+		return nil
+	}
+
+	if skipped {
+		// a probe that didn't get to run doesn't tell us anything.
+		if ticket.probe {
+			b.probing = false
+		}
+		return nil
+	}
+
+	switch b.state {
+	case BreakerHalfOpen:
+		if !ticket.probe {
+			return nil
+		}
+
+		b.probing = false
+		if failed {
+			return cb.transition(experiment, candidate, b, BreakerOpen)
+		}
+
+		return cb.transition(experiment, candidate, b, BreakerClosed)
+	case BreakerClosed:
+		if time.Since(b.since) > cb.config.Window {
+			b.since = time.Now()
+			b.runs, b.failures = 0, 0
+		}
+
+		b.runs++
+		if !failed {
+			b.consecutive = 0
+			return nil
+		}
+
+		b.failures++
+		b.consecutive++
+		if cb.tripped(b) {
+			return cb.transition(experiment, candidate, b, BreakerOpen)
+		}
+	}
+
+	return nil
+}
+
+func (cb *CircuitBreaker) tripped(b *breaker) bool {
+	if n := cb.config.ConsecutiveFailures; n > 0 && b.consecutive >= n {
+		return true
+	}
+
+	if r := cb.config.FailureRatio; r > 0 && b.runs >= cb.config.MinRuns {
+		return float64(b.failures)/float64(b.runs) >= r
+	}
+
+	return false
+}
+
+func (cb *CircuitBreaker) transition(experiment, candidate string, b *breaker, to BreakerState) *BreakerEvent {
+	event := &BreakerEvent{
+		Experiment: experiment,
+		Candidate:  candidate,
+		From:       b.state,
+		To:         to,
+	}
+
+	b.state = to
+	b.since = time.Now()
+	b.generation++
+	b.runs, b.failures, b.consecutive = 0, 0, 0
+
+	return event
+}
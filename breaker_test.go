@@ -0,0 +1,239 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("it should trip after consecutive failures", func(t *testing.T) {
+		cb := experiment.NewCircuitBreaker(experiment.BreakerConfig{
+			ConsecutiveFailures: 2,
+			CoolDown:            20 * time.Millisecond,
+		})
+
+		pub := &breakerPublisher{}
+		fail := errors.New("failure")
+
+		runBreaker(t, cb, pub, fail)
+		runBreaker(t, cb, pub, fail)
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerOpen {
+			t.Fatalf("Expected the breaker to be open, got %s", state)
+		}
+
+		obs := runBreaker(t, cb, pub, nil)
+		if !obs.Skipped || !errors.Is(obs.Error, experiment.ErrCircuitOpen) {
+			t.Errorf("Expected the candidate to be skipped, got %+v", obs)
+		}
+
+		time.Sleep(30 * time.Millisecond)
+		obs = runBreaker(t, cb, pub, nil)
+		if obs.Skipped {
+			t.Errorf("Expected the candidate to be probed")
+		}
+
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerClosed {
+			t.Errorf("Expected the breaker to be closed, got %s", state)
+		}
+
+		expected := []experiment.BreakerState{experiment.BreakerOpen, experiment.BreakerHalfOpen, experiment.BreakerClosed}
+		if len(pub.events) != len(expected) {
+			t.Fatalf("Expected %d events, got %d", len(expected), len(pub.events))
+		}
+
+		for i, state := range expected {
+			if pub.events[i].To != state {
+				t.Errorf("Expected transition %d to be to %s, got %s", i, state, pub.events[i].To)
+			}
+		}
+	})
+
+	t.Run("it should trip at a failure ratio", func(t *testing.T) {
+		cb := experiment.NewCircuitBreaker(experiment.BreakerConfig{
+			FailureRatio: 0.5,
+			MinRuns:      4,
+		})
+
+		pub := &breakerPublisher{}
+		fail := errors.New("failure")
+		for i, err := range []error{nil, fail, nil} {
+			runBreaker(t, cb, pub, err)
+			if state := cb.State("breaker", "candidate"); state != experiment.BreakerClosed {
+				t.Errorf("Expected the breaker to be closed after %d runs, got %s", i+1, state)
+			}
+		}
+
+		runBreaker(t, cb, pub, fail)
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerOpen {
+			t.Errorf("Expected the breaker to be open, got %s", state)
+		}
+	})
+
+	t.Run("it should open again when the probe fails", func(t *testing.T) {
+		cb := experiment.NewCircuitBreaker(experiment.BreakerConfig{
+			ConsecutiveFailures: 1,
+			CoolDown:            time.Millisecond,
+		})
+
+		pub := &breakerPublisher{}
+		fail := errors.New("failure")
+		runBreaker(t, cb, pub, fail)
+
+		time.Sleep(5 * time.Millisecond)
+		runBreaker(t, cb, pub, fail)
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerOpen {
+			t.Errorf("Expected the breaker to be open, got %s", state)
+		}
+	})
+
+	t.Run("it should not count errors which match the control", func(t *testing.T) {
+		cb := experiment.NewCircuitBreaker(experiment.BreakerConfig{
+			ConsecutiveFailures: 3,
+		})
+
+		notFound := errors.New("not found")
+		for i := 0; i < 5; i++ {
+			exp := experiment.New[string](
+				experiment.WithName("breaker"),
+				experiment.WithCircuitBreaker(cb),
+			)
+			exp.Force(true)
+
+			exp.Control(func(context.Context) (string, error) {
+				return "", notFound
+			})
+
+			exp.Candidate("candidate", func(context.Context) (string, error) {
+				return "", notFound
+			})
+
+			exp.CompareErrors(experiment.ErrorsIs)
+
+			res := exp.RunWithResult(context.Background())
+			if !errors.Is(res.Error, notFound) {
+				t.Fatalf("Expected the error of the control, got %v", res.Error)
+			}
+
+			if obs, _ := res.Candidate("candidate"); obs.Skipped || !obs.Success {
+				t.Errorf("Expected run %d to match the control, got %+v", i+1, obs)
+			}
+		}
+
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerClosed {
+			t.Errorf("Expected the breaker to be closed, got %s", state)
+		}
+	})
+
+	t.Run("it should only let the probe close the breaker", func(t *testing.T) {
+		cb := experiment.NewCircuitBreaker(experiment.BreakerConfig{
+			ConsecutiveFailures: 1,
+			CoolDown:            time.Millisecond,
+		})
+
+		type input struct {
+			release chan struct{}
+			err     error
+		}
+
+		def := experiment.NewDefinition[input, string](
+			experiment.WithName("breaker"),
+			experiment.WithPercentage(100),
+			experiment.WithConcurrency(),
+			experiment.WithCircuitBreaker(cb),
+		)
+		def.Control(func(context.Context, input) (string, error) {
+			return "control", nil
+		})
+		def.Candidate("candidate", func(_ context.Context, in input) (string, error) {
+			if in.release != nil {
+				<-in.release
+			}
+			return "candidate", in.err
+		})
+
+		ctx := context.Background()
+		slow := input{release: make(chan struct{})}
+		late := def.Run(ctx, slow)
+
+		if err := def.Run(ctx, input{err: errors.New("failure")}).Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerOpen {
+			t.Fatalf("Expected the breaker to be open, got %s", state)
+		}
+
+		time.Sleep(5 * time.Millisecond)
+		probe := input{release: make(chan struct{})}
+		probed := def.Run(ctx, probe)
+
+		close(slow.release)
+		if err := late.Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerHalfOpen {
+			t.Errorf("Expected a run from before the trip not to decide the probe, got %s", state)
+		}
+
+		close(probe.release)
+		if err := probed.Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		if state := cb.State("breaker", "candidate"); state != experiment.BreakerClosed {
+			t.Errorf("Expected the probe to close the breaker, got %s", state)
+		}
+	})
+}
+
+// runBreaker runs an experiment with a single candidate returning err and
+// returns the observation of the candidate.
+func runBreaker(t *testing.T, cb *experiment.CircuitBreaker, pub *breakerPublisher, err error) experiment.Observation[string] {
+	exp := experiment.New[string](
+		experiment.WithName("breaker"),
+		experiment.WithCircuitBreaker(cb),
+	).WithPublisher(pub)
+	exp.Force(true)
+
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+
+	exp.Candidate("candidate", func(context.Context) (string, error) {
+		return "candidate", err
+	})
+
+	var obs experiment.Observation[string]
+	pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
+		if o.Name == "candidate" {
+			obs = o
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	if _, err := exp.Run(ctx); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	if err := exp.Publish(ctx); err != nil {
+		t.Errorf("Expected no error publishing, got %s", err)
+	}
+
+	return obs
+}
+
+type breakerPublisher struct {
+	testPublisher[string]
+	events []experiment.BreakerEvent
+}
+
+func (p *breakerPublisher) PublishBreakerEvent(_ context.Context, e experiment.BreakerEvent) error {
+	p.events = append(p.events, e)
+	return nil
+}
@@ -0,0 +1,434 @@
+// Package compare provides comparators for experiments which describe the
+// differences between the value of the control and a candidate.
+package compare
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+	"unsafe"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Deep returns a Comparator which walks structs, maps, slices, arrays and
+// pointers and reports every value that differs, with the path to it.
+// Struct fields are written as `.Field`, indexes as `[0]` and map keys as
+// `["key"]` or `[1]`. Elements that are only present on one side are reported
+// with a nil value for the other side.
+// Without options, values are compared like reflect.DeepEqual does, except for
+// times which are equal when they represent the same instant, also in
+// unexported fields. Times in unexported maps and interfaces are compared field
+// by field instead. As with reflect.DeepEqual, NaN is never equal, so a NaN is
+// always reported.
+func Deep[C any](opts ...Option) experiment.Comparator[C] {
+	o := newOptions(opts)
+
+	return experiment.ComparatorFunc[C](func(control, candidate C) experiment.Comparison {
+		w := &walker{options: o, visited: map[visit]bool{}}
+		w.walk("", reflect.ValueOf(&control).Elem(), reflect.ValueOf(&candidate).Elem())
+
+		return experiment.Comparison{
+			Match:       len(w.differences) == 0,
+			Differences: w.differences,
+		}
+	})
+}
+
+// visit represents a pair of pointers that is being compared, to stop at
+// cyclic values.
+type visit struct {
+	control   uintptr
+	candidate uintptr
+	typ       reflect.Type
+}
+
+type walker struct {
+	*options
+
+	visited     map[visit]bool
+	differences []experiment.Difference
+}
+
+// differ records a difference. A value that is only present on one side is
+// recorded as added or removed.
+func (w *walker) differ(path string, control, candidate reflect.Value) {
+	kind := experiment.DifferenceChanged
+	switch {
+	case !control.IsValid():
+		kind = experiment.DifferenceAdded
+	case !candidate.IsValid():
+		kind = experiment.DifferenceRemoved
+	}
+
+	w.differences = append(w.differences, experiment.Difference{
+		Path:      path,
+		Kind:      kind,
+		Control:   value(control),
+		Candidate: value(candidate),
+	})
+}
+
+// equal reports whether the values at path are equal, without recording any
+// differences.
+func (w *walker) equal(path string, control, candidate reflect.Value) bool {
+	sub := &walker{options: w.options, visited: map[visit]bool{}}
+	sub.walk(path, control, candidate)
+
+	return len(sub.differences) == 0
+}
+
+func (w *walker) walk(path string, control, candidate reflect.Value) {
+	if w.ignoredPath(path) {
+		return
+	}
+
+	if !control.IsValid() || !candidate.IsValid() {
+		if control.IsValid() != candidate.IsValid() {
+			w.differ(path, control, candidate)
+		}
+		return
+	}
+
+	if control.Type() != candidate.Type() {
+		w.differ(path, control, candidate)
+		return
+	}
+
+	if control.Type() == timeType {
+		c, ok := timeValue(control)
+		d, dok := timeValue(candidate)
+		if ok && dok {
+			if !w.equalTime(c, d) {
+				w.differ(path, control, candidate)
+			}
+			return
+		}
+	}
+
+	switch control.Kind() {
+	case reflect.Pointer:
+		if control.IsNil() || candidate.IsNil() {
+			if control.IsNil() != candidate.IsNil() {
+				w.differ(path, control, candidate)
+			}
+			return
+		}
+
+		if w.seen(control, candidate) {
+			return
+		}
+
+		w.walk(path, control.Elem(), candidate.Elem())
+	case reflect.Interface:
+		if control.IsNil() || candidate.IsNil() {
+			if control.IsNil() != candidate.IsNil() {
+				w.differ(path, control, candidate)
+			}
+			return
+		}
+
+		w.walk(path, control.Elem(), candidate.Elem())
+	case reflect.Struct:
+		for i := 0; i < control.NumField(); i++ {
+			field := control.Type().Field(i)
+			if w.ignoredField(field) {
+				continue
+			}
+
+			w.walk(path+"."+field.Name, control.Field(i), candidate.Field(i))
+		}
+	case reflect.Slice:
+		if w.nilDiffers(control, candidate) {
+			w.differ(path, control, candidate)
+			return
+		}
+
+		w.walkSequence(path, control, candidate)
+	case reflect.Array:
+		w.walkSequence(path, control, candidate)
+	case reflect.Map:
+		if w.nilDiffers(control, candidate) {
+			w.differ(path, control, candidate)
+			return
+		}
+
+		if w.seen(control, candidate) {
+			return
+		}
+
+		w.walkMap(path, control, candidate)
+	case reflect.Float32, reflect.Float64:
+		if !w.equalFloat(control.Float(), candidate.Float()) {
+			w.differ(path, control, candidate)
+		}
+	case reflect.Func:
+		// like reflect.DeepEqual, functions are only equal when both are nil.
+		if !control.IsNil() || !candidate.IsNil() {
+			w.differ(path, control, candidate)
+		}
+	case reflect.Chan, reflect.UnsafePointer:
+		if control.Pointer() != candidate.Pointer() {
+			w.differ(path, control, candidate)
+		}
+	default:
+		if !equalScalar(control, candidate) {
+			w.differ(path, control, candidate)
+		}
+	}
+}
+
+func (w *walker) walkSequence(path string, control, candidate reflect.Value) {
+	if k, ok := w.keyer(path); ok {
+		if w.walkKeyed(path, k, control, candidate) {
+			return
+		}
+	}
+
+	if w.unorderedPath(path) {
+		w.walkUnordered(path, control, candidate)
+		return
+	}
+
+	n := control.Len()
+	if candidate.Len() > n {
+		n = candidate.Len()
+	}
+
+	for i := 0; i < n; i++ {
+		w.walk(fmt.Sprintf("%s[%d]", path, i), index(control, i), index(candidate, i))
+	}
+}
+
+// walkUnordered compares the elements as multisets. Every element of the
+// control is matched with the first equal element of the candidate which
+// isn't matched yet.
+func (w *walker) walkUnordered(path string, control, candidate reflect.Value) {
+	matched := make([]bool, candidate.Len())
+	var removed []int
+	for i := 0; i < control.Len(); i++ {
+		found := false
+		for j := 0; j < candidate.Len(); j++ {
+			if !matched[j] && w.equal(fmt.Sprintf("%s[%d]", path, i), control.Index(i), candidate.Index(j)) {
+				matched[j] = true
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			removed = append(removed, i)
+		}
+	}
+
+	for _, i := range removed {
+		w.differ(fmt.Sprintf("%s[%d]", path, i), control.Index(i), reflect.Value{})
+	}
+
+	for j, ok := range matched {
+		if !ok {
+			w.differ(fmt.Sprintf("%s[%d]", path, j), reflect.Value{}, candidate.Index(j))
+		}
+	}
+}
+
+// walkKeyed matches the elements by their key. It returns false, without
+// recording differences, when the key of an element can't be extracted.
+func (w *walker) walkKeyed(path string, k keyer, control, candidate reflect.Value) bool {
+	controlKeys, ok := w.keys(k, control)
+	if !ok {
+		return false
+	}
+
+	candidateKeys, ok := w.keys(k, candidate)
+	if !ok {
+		return false
+	}
+
+	// elements with the same key are paired in order, the ones left over are
+	// removed from the control or added by the candidate.
+	byKey := make(map[interface{}][]int, len(candidateKeys))
+	for j, key := range candidateKeys {
+		byKey[key] = append(byKey[key], j)
+	}
+
+	for i, key := range controlKeys {
+		elem := reflect.Value{}
+		if js := byKey[key]; len(js) > 0 {
+			elem = candidate.Index(js[0])
+			byKey[key] = js[1:]
+		}
+		w.walk(path+keyPath(key), control.Index(i), elem)
+	}
+
+	for j, key := range candidateKeys {
+		if js := byKey[key]; len(js) > 0 && js[0] == j {
+			w.walk(path+keyPath(key), reflect.Value{}, candidate.Index(j))
+			byKey[key] = js[1:]
+		}
+	}
+
+	return true
+}
+
+// keys returns the keys of the elements of v.
+func (w *walker) keys(k keyer, v reflect.Value) ([]interface{}, bool) {
+	keys := make([]interface{}, v.Len())
+	for i := range keys {
+		elem := v.Index(i)
+		if !elem.CanInterface() {
+			return nil, false
+		}
+
+		key, ok := k.fnc(elem.Interface())
+		if !ok {
+			return nil, false
+		}
+		keys[i] = key
+	}
+
+	return keys, true
+}
+
+func (w *walker) walkMap(path string, control, candidate reflect.Value) {
+	keys := control.MapKeys()
+	for _, k := range candidate.MapKeys() {
+		if !control.MapIndex(k).IsValid() {
+			keys = append(keys, k)
+		}
+	}
+
+	paths := make([]string, len(keys))
+	for i, k := range keys {
+		paths[i] = path + key(k)
+	}
+
+	sort.Sort(byPath{paths: paths, keys: keys})
+	for i, k := range keys {
+		w.walk(paths[i], control.MapIndex(k), candidate.MapIndex(k))
+	}
+}
+
+// nilDiffers reports whether a slice or map is nil on one side only, taking
+// NilEqualsEmpty into account.
+func (w *walker) nilDiffers(control, candidate reflect.Value) bool {
+	if control.IsNil() == candidate.IsNil() {
+		return false
+	}
+
+	return !w.nilEqualsEmpty || control.Len() != 0 || candidate.Len() != 0
+}
+
+// seen reports whether the pair of values is already being compared.
+func (w *walker) seen(control, candidate reflect.Value) bool {
+	v := visit{control: control.Pointer(), candidate: candidate.Pointer(), typ: control.Type()}
+	if w.visited[v] {
+		return true
+	}
+
+	w.visited[v] = true
+	return false
+}
+
+// timeValue returns the time v holds. Times in unexported fields can't be
+// returned through reflection, so they're read from their address instead.
+// Times in unexported maps and interfaces have no address, for these it
+// returns false.
+func timeValue(v reflect.Value) (time.Time, bool) {
+	if v.CanInterface() {
+		return v.Interface().(time.Time), true
+	}
+
+	if v.CanAddr() {
+		return *(*time.Time)(unsafe.Pointer(v.UnsafeAddr())), true
+	}
+
+	return time.Time{}, false
+}
+
+func (w *walker) equalTime(control, candidate time.Time) bool {
+	d := control.Sub(candidate)
+	if d < 0 {
+		d = -d
+	}
+
+	return d <= w.timeTolerance
+}
+
+// equalFloat reports whether the floats are within the epsilon of each other.
+// Like reflect.DeepEqual, NaN is not equal to any value, not even NaN.
+func (w *walker) equalFloat(control, candidate float64) bool {
+	return control == candidate || math.Abs(control-candidate) <= w.epsilon
+}
+
+func equalScalar(control, candidate reflect.Value) bool {
+	switch control.Kind() {
+	case reflect.Bool:
+		return control.Bool() == candidate.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return control.Int() == candidate.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return control.Uint() == candidate.Uint()
+	case reflect.Complex64, reflect.Complex128:
+		return control.Complex() == candidate.Complex()
+	case reflect.String:
+		return control.String() == candidate.String()
+	default:
+		return false
+	}
+}
+
+// index returns the element at i, or the zero Value when i is out of range.
+func index(v reflect.Value, i int) reflect.Value {
+	if i >= v.Len() {
+		return reflect.Value{}
+	}
+
+	return v.Index(i)
+}
+
+// key returns the path segment of a map key.
+func key(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return fmt.Sprintf("[%q]", k.String())
+	}
+
+	return fmt.Sprintf("[%v]", value(k))
+}
+
+// keyPath returns the path segment of the key of a keyed element.
+func keyPath(k interface{}) string {
+	return key(reflect.ValueOf(k))
+}
+
+// value returns the value to record on a Difference. Values of unexported
+// fields can't be returned as is, so they're formatted instead.
+func value(v reflect.Value) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.CanInterface() {
+		return v.Interface()
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// byPath sorts map keys by their path, so differences are reported in a
+// stable order.
+type byPath struct {
+	paths []string
+	keys  []reflect.Value
+}
+
+func (b byPath) Len() int           { return len(b.paths) }
+func (b byPath) Less(i, j int) bool { return b.paths[i] < b.paths[j] }
+func (b byPath) Swap(i, j int) {
+	b.paths[i], b.paths[j] = b.paths[j], b.paths[i]
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+}
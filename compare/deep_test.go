@@ -0,0 +1,332 @@
+package compare_test
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jelmersnoeck/experiment/v3"
+	"github.com/jelmersnoeck/experiment/v3/compare"
+)
+
+type address struct {
+	Street string
+	Number int
+}
+
+type user struct {
+	Name      string
+	Score     float64
+	Address   *address
+	Tags      []string
+	Labels    map[string]string
+	UpdatedAt time.Time
+	RequestID string `experiment:"ignore"`
+	Friends   []*user
+	secret    string
+}
+
+func TestDeep(t *testing.T) {
+	now := time.Now()
+	base := func() user {
+		return user{
+			Name:      "jane",
+			Score:     1.5,
+			Address:   &address{Street: "Main", Number: 1},
+			Tags:      []string{"a", "b"},
+			Labels:    map[string]string{"team": "core"},
+			UpdatedAt: now,
+			RequestID: "1",
+			secret:    "s",
+		}
+	}
+
+	tcs := map[string]struct {
+		opts        []compare.Option
+		change      func(*user)
+		differences []experiment.Difference
+	}{
+		"equal": {
+			change: func(*user) {},
+		},
+		"field": {
+			change: func(u *user) { u.Name = "john" },
+			differences: []experiment.Difference{
+				{Path: ".Name", Control: "jane", Candidate: "john"},
+			},
+		},
+		"pointer field": {
+			change: func(u *user) { u.Address.Number = 2 },
+			differences: []experiment.Difference{
+				{Path: ".Address.Number", Control: 1, Candidate: 2},
+			},
+		},
+		"nil pointer": {
+			change: func(u *user) { u.Address = nil },
+			differences: []experiment.Difference{
+				{Path: ".Address", Control: &address{Street: "Main", Number: 1}, Candidate: (*address)(nil)},
+			},
+		},
+		"slice element": {
+			change: func(u *user) { u.Tags = []string{"a", "c", "d"} },
+			differences: []experiment.Difference{
+				{Path: ".Tags[1]", Control: "b", Candidate: "c"},
+				{Path: ".Tags[2]", Kind: experiment.DifferenceAdded, Control: nil, Candidate: "d"},
+			},
+		},
+		"map key": {
+			change: func(u *user) { u.Labels = map[string]string{"team": "web", "env": "prod"} },
+			differences: []experiment.Difference{
+				{Path: `.Labels["env"]`, Kind: experiment.DifferenceAdded, Control: nil, Candidate: "prod"},
+				{Path: `.Labels["team"]`, Control: "core", Candidate: "web"},
+			},
+		},
+		"unexported field": {
+			change: func(u *user) { u.secret = "t" },
+			differences: []experiment.Difference{
+				{Path: ".secret", Control: "s", Candidate: "t"},
+			},
+		},
+		"times in another location": {
+			change: func(u *user) { u.UpdatedAt = now.UTC() },
+		},
+		"time": {
+			change: func(u *user) { u.UpdatedAt = now.Add(time.Second) },
+			differences: []experiment.Difference{
+				{Path: ".UpdatedAt", Control: now, Candidate: now.Add(time.Second)},
+			},
+		},
+		"time within tolerance": {
+			opts:   []compare.Option{compare.TimeTolerance(time.Minute)},
+			change: func(u *user) { u.UpdatedAt = now.Add(time.Second) },
+		},
+		"float": {
+			change: func(u *user) { u.Score = 1.50001 },
+			differences: []experiment.Difference{
+				{Path: ".Score", Control: 1.5, Candidate: 1.50001},
+			},
+		},
+		"float within epsilon": {
+			opts:   []compare.Option{compare.FloatEpsilon(0.001)},
+			change: func(u *user) { u.Score = 1.50001 },
+		},
+		"nil slice": {
+			change: func(u *user) { u.Friends = []*user{} },
+			differences: []experiment.Difference{
+				{Path: ".Friends", Control: []*user(nil), Candidate: []*user{}},
+			},
+		},
+		"nil slice equals empty": {
+			opts:   []compare.Option{compare.NilEqualsEmpty()},
+			change: func(u *user) { u.Friends = []*user{} },
+		},
+		"nil map equals empty": {
+			opts:   []compare.Option{compare.NilEqualsEmpty()},
+			change: func(u *user) { u.Labels = nil },
+			differences: []experiment.Difference{
+				{Path: ".Labels", Control: map[string]string{"team": "core"}, Candidate: map[string]string(nil)},
+			},
+		},
+		"ignored tag": {
+			opts:   []compare.Option{compare.IgnoreTag("experiment", "ignore")},
+			change: func(u *user) { u.RequestID = "2" },
+		},
+		"ignored path": {
+			opts:   []compare.Option{compare.IgnorePaths(".Address.Number", `.Labels["team"]`)},
+			change: func(u *user) { u.Address.Number = 2; u.Labels["team"] = "web" },
+		},
+		"ignored wildcard path": {
+			opts:   []compare.Option{compare.IgnorePaths(".Tags[*]")},
+			change: func(u *user) { u.Tags = []string{"c", "d"} },
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			control, candidate := base(), base()
+			candidate.Address = &address{Street: "Main", Number: 1}
+			candidate.Labels = map[string]string{"team": "core"}
+			tc.change(&candidate)
+
+			c := compare.Deep[user](tc.opts...).Compare(control, candidate)
+			if c.Match != (len(tc.differences) == 0) {
+				t.Errorf("Expected match to be %t, got %t", len(tc.differences) == 0, c.Match)
+			}
+
+			if !reflect.DeepEqual(c.Differences, tc.differences) {
+				t.Errorf("Expected differences %+v, got %+v", tc.differences, c.Differences)
+			}
+		})
+	}
+}
+
+func TestDeep_UnexportedTime(t *testing.T) {
+	type event struct {
+		at time.Time
+	}
+
+	now := time.Now()
+	tcs := map[string]struct {
+		opts      []compare.Option
+		candidate time.Time
+		match     bool
+	}{
+		"same instant in another location": {candidate: now.UTC(), match: true},
+		"another instant":                  {candidate: now.Add(time.Second)},
+		"within tolerance": {
+			opts:      []compare.Option{compare.TimeTolerance(time.Minute)},
+			candidate: now.Add(time.Second),
+			match:     true,
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c := compare.Deep[event](tc.opts...).Compare(event{at: now}, event{at: tc.candidate})
+			if c.Match != tc.match {
+				t.Errorf("Expected match to be %t, got %t: %+v", tc.match, c.Match, c.Differences)
+			}
+
+			if !tc.match && (len(c.Differences) != 1 || c.Differences[0].Path != ".at") {
+				t.Errorf("Expected a difference at .at, got %+v", c.Differences)
+			}
+		})
+	}
+}
+
+func TestDeep_NaN(t *testing.T) {
+	tcs := map[string]struct {
+		opts               []compare.Option
+		control, candidate float64
+		match              bool
+	}{
+		"NaN candidate":              {control: 1, candidate: math.NaN()},
+		"NaN control":                {control: math.NaN(), candidate: 1},
+		"NaN on both sides":          {control: math.NaN(), candidate: math.NaN()},
+		"NaN candidate with epsilon": {opts: []compare.Option{compare.FloatEpsilon(1)}, control: 1, candidate: math.NaN()},
+		"infinity":                   {control: math.Inf(1), candidate: math.Inf(1), match: true},
+		"infinity with epsilon":      {opts: []compare.Option{compare.FloatEpsilon(1)}, control: math.Inf(1), candidate: math.Inf(1), match: true},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c := compare.Deep[float64](tc.opts...).Compare(tc.control, tc.candidate)
+			if c.Match != tc.match {
+				t.Errorf("Expected match to be %t, got %t", tc.match, c.Match)
+			}
+
+			if !tc.match && len(c.Differences) != 1 {
+				t.Errorf("Expected 1 difference, got %+v", c.Differences)
+			}
+		})
+	}
+}
+
+func TestDeep_Cycle(t *testing.T) {
+	control := &user{Name: "jane"}
+	control.Friends = []*user{control}
+	candidate := &user{Name: "jane"}
+	candidate.Friends = []*user{candidate}
+
+	if c := compare.Deep[*user]().Compare(control, candidate); !c.Match {
+		t.Errorf("Expected cyclic values to match, got %+v", c.Differences)
+	}
+}
+
+type item struct {
+	ID    int
+	Name  string
+	Price float64
+}
+
+func TestDeep_Collections(t *testing.T) {
+	byID := compare.KeyBy(".Items", func(i item) int { return i.ID })
+
+	tcs := map[string]struct {
+		opts        []compare.Option
+		control     []item
+		candidate   []item
+		differences []experiment.Difference
+	}{
+		"unordered": {
+			opts:      []compare.Option{compare.Unordered()},
+			control:   []item{{ID: 1}, {ID: 2}, {ID: 2}},
+			candidate: []item{{ID: 2}, {ID: 1}, {ID: 2}},
+		},
+		"unordered with duplicates": {
+			opts:      []compare.Option{compare.Unordered(".Items")},
+			control:   []item{{ID: 1}, {ID: 2}, {ID: 2}},
+			candidate: []item{{ID: 2}, {ID: 1}, {ID: 3}},
+			differences: []experiment.Difference{
+				{Path: ".Items[2]", Kind: experiment.DifferenceRemoved, Control: item{ID: 2}},
+				{Path: ".Items[2]", Kind: experiment.DifferenceAdded, Candidate: item{ID: 3}},
+			},
+		},
+		"unordered with ignored fields": {
+			opts:      []compare.Option{compare.Unordered(), compare.IgnorePaths(".Items[*].Name")},
+			control:   []item{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}},
+			candidate: []item{{ID: 2, Name: "c"}, {ID: 1, Name: "d"}},
+		},
+		"keyed": {
+			opts:      []compare.Option{byID},
+			control:   []item{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 3, Name: "c"}},
+			candidate: []item{{ID: 4, Name: "d"}, {ID: 2, Name: "e"}, {ID: 1, Name: "a"}},
+			differences: []experiment.Difference{
+				{Path: ".Items[2].Name", Control: "b", Candidate: "e"},
+				{Path: ".Items[3]", Kind: experiment.DifferenceRemoved, Control: item{ID: 3, Name: "c"}},
+				{Path: ".Items[4]", Kind: experiment.DifferenceAdded, Candidate: item{ID: 4, Name: "d"}},
+			},
+		},
+		"keyed with a duplicate removed": {
+			opts:      []compare.Option{byID},
+			control:   []item{{ID: 1, Name: "a"}, {ID: 1, Name: "a"}},
+			candidate: []item{{ID: 1, Name: "a"}},
+			differences: []experiment.Difference{
+				{Path: ".Items[1]", Kind: experiment.DifferenceRemoved, Control: item{ID: 1, Name: "a"}},
+			},
+		},
+		"keyed with a duplicate added": {
+			opts:      []compare.Option{byID},
+			control:   []item{{ID: 1, Name: "a"}},
+			candidate: []item{{ID: 1, Name: "a"}, {ID: 1, Name: "b"}},
+			differences: []experiment.Difference{
+				{Path: ".Items[1]", Kind: experiment.DifferenceAdded, Candidate: item{ID: 1, Name: "b"}},
+			},
+		},
+		"keyed with duplicates paired in order": {
+			opts:      []compare.Option{byID},
+			control:   []item{{ID: 1, Name: "a"}, {ID: 2, Name: "b"}, {ID: 1, Name: "c"}},
+			candidate: []item{{ID: 1, Name: "a"}, {ID: 1, Name: "d"}, {ID: 2, Name: "b"}},
+			differences: []experiment.Difference{
+				{Path: ".Items[1].Name", Control: "c", Candidate: "d"},
+			},
+		},
+		"keyed with another path": {
+			opts:      []compare.Option{compare.KeyBy(".Other", func(i item) int { return i.ID })},
+			control:   []item{{ID: 1}, {ID: 2}},
+			candidate: []item{{ID: 2}, {ID: 1}},
+			differences: []experiment.Difference{
+				{Path: ".Items[0].ID", Control: 1, Candidate: 2},
+				{Path: ".Items[1].ID", Control: 2, Candidate: 1},
+			},
+		},
+	}
+
+	type order struct {
+		Items []item
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c := compare.Deep[order](tc.opts...).Compare(order{tc.control}, order{tc.candidate})
+			if c.Match != (len(tc.differences) == 0) {
+				t.Errorf("Expected match to be %t, got %t", len(tc.differences) == 0, c.Match)
+			}
+
+			if !reflect.DeepEqual(c.Differences, tc.differences) {
+				t.Errorf("Expected differences %+v, got %+v", tc.differences, c.Differences)
+			}
+		})
+	}
+}
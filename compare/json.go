@@ -0,0 +1,231 @@
+package compare
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+// IgnoreJSONPaths ignores the values selected by the given JSONPath
+// expressions when comparing JSON, together with everything they hold. The
+// supported expressions select members and array elements, e.g.
+// `$.request_id`, `$.items[*].generated_at`, `$['meta']` or `$..trace_id`.
+// IgnoreJSONPaths panics when an expression can't be parsed.
+func IgnoreJSONPaths(exprs ...string) Option {
+	paths := make([]jsonPath, len(exprs))
+	for i, expr := range exprs {
+		p, err := parseJSONPath(expr)
+		if err != nil {
+			panic(err)
+		}
+		paths[i] = p
+	}
+
+	return func(o *options) {
+		o.jsonPaths = append(o.jsonPaths, paths...)
+	}
+}
+
+// JSON returns a Comparator which parses the JSON encoded values and compares
+// them semantically, so the order of the members and whitespace don't matter.
+// Numbers are equal when they have the same value, e.g. 1 and 1.0, or differ
+// by at most the FloatEpsilon. Members ignored with IgnoreJSONPaths aren't
+// compared.
+// Differences are reported with a JSON pointer as path, e.g. `/items/0/id`,
+// and the decoded values. When a value is not valid JSON, the values are only
+// equal when they are byte for byte the same.
+func JSON[C ~[]byte | ~string](opts ...Option) experiment.Comparator[C] {
+	o := newOptions(opts)
+
+	return experiment.ComparatorFunc[C](func(control, candidate C) experiment.Comparison {
+		controlValue, controlErr := decodeJSON([]byte(control))
+		candidateValue, candidateErr := decodeJSON([]byte(candidate))
+		if controlErr != nil || candidateErr != nil {
+			if string(control) == string(candidate) {
+				return experiment.Comparison{Match: true}
+			}
+
+			return experiment.Comparison{
+				Differences: []experiment.Difference{
+					{Control: string(control), Candidate: string(candidate)},
+				},
+			}
+		}
+
+		w := &jsonWalker{options: o}
+		w.walk(nil, controlValue, candidateValue)
+
+		return experiment.Comparison{
+			Match:       len(w.differences) == 0,
+			Differences: w.differences,
+		}
+	})
+}
+
+func decodeJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("compare: unexpected data after JSON value")
+	}
+
+	return v, nil
+}
+
+type jsonWalker struct {
+	*options
+
+	differences []experiment.Difference
+}
+
+func (w *jsonWalker) differ(path []string, kind experiment.DifferenceKind, control, candidate interface{}) {
+	w.differences = append(w.differences, experiment.Difference{
+		Path:      pointer(path),
+		Kind:      kind,
+		Control:   control,
+		Candidate: candidate,
+	})
+}
+
+func (w *jsonWalker) ignored(path []string) bool {
+	for _, p := range w.jsonPaths {
+		if p.match(path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w *jsonWalker) walk(path []string, control, candidate interface{}) {
+	if w.ignored(path) {
+		return
+	}
+
+	switch c := control.(type) {
+	case map[string]interface{}:
+		d, ok := candidate.(map[string]interface{})
+		if !ok {
+			w.differ(path, experiment.DifferenceChanged, control, candidate)
+			return
+		}
+
+		w.walkObject(path, c, d)
+	case []interface{}:
+		d, ok := candidate.([]interface{})
+		if !ok {
+			w.differ(path, experiment.DifferenceChanged, control, candidate)
+			return
+		}
+
+		w.walkArray(path, c, d)
+	case json.Number:
+		d, ok := candidate.(json.Number)
+		if !ok || !w.equalNumber(c, d) {
+			w.differ(path, experiment.DifferenceChanged, control, candidate)
+		}
+	default:
+		// strings, booleans and null are comparable.
+		if control != candidate {
+			w.differ(path, experiment.DifferenceChanged, control, candidate)
+		}
+	}
+}
+
+func (w *jsonWalker) walkObject(path []string, control, candidate map[string]interface{}) {
+	keys := make([]string, 0, len(control))
+	for k := range control {
+		keys = append(keys, k)
+	}
+	for k := range candidate {
+		if _, ok := control[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		w.walkMember(append(path[:len(path):len(path)], k), control, candidate, k)
+	}
+}
+
+func (w *jsonWalker) walkMember(path []string, control, candidate map[string]interface{}, k string) {
+	c, cok := control[k]
+	d, dok := candidate[k]
+	switch {
+	case w.ignored(path):
+	case !dok:
+		w.differ(path, experiment.DifferenceRemoved, c, nil)
+	case !cok:
+		w.differ(path, experiment.DifferenceAdded, nil, d)
+	default:
+		w.walk(path, c, d)
+	}
+}
+
+func (w *jsonWalker) walkArray(path []string, control, candidate []interface{}) {
+	n := len(control)
+	if len(candidate) > n {
+		n = len(candidate)
+	}
+
+	for i := 0; i < n; i++ {
+		p := append(path[:len(path):len(path)], strconv.Itoa(i))
+		switch {
+		case w.ignored(p):
+		case i >= len(candidate):
+			w.differ(p, experiment.DifferenceRemoved, control[i], nil)
+		case i >= len(control):
+			w.differ(p, experiment.DifferenceAdded, nil, candidate[i])
+		default:
+			w.walk(p, control[i], candidate[i])
+		}
+	}
+}
+
+// equalNumber compares numbers by their value. Without an epsilon they are
+// compared exactly, so large integers don't lose precision.
+func (w *jsonWalker) equalNumber(control, candidate json.Number) bool {
+	if w.epsilon > 0 {
+		c, cerr := control.Float64()
+		d, derr := candidate.Float64()
+		if cerr == nil && derr == nil {
+			return math.Abs(c-d) <= w.epsilon
+		}
+	}
+
+	c, cok := new(big.Rat).SetString(control.String())
+	d, dok := new(big.Rat).SetString(candidate.String())
+	if !cok || !dok {
+		return control == candidate
+	}
+
+	return c.Cmp(d) == 0
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+// pointer returns the JSON pointer, as defined in RFC 6901, of the path.
+func pointer(path []string) string {
+	var b strings.Builder
+	for _, p := range path {
+		b.WriteByte('/')
+		b.WriteString(pointerEscaper.Replace(p))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package compare_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/jelmersnoeck/experiment/v3"
+	"github.com/jelmersnoeck/experiment/v3/compare"
+)
+
+func TestJSON(t *testing.T) {
+	tcs := map[string]struct {
+		opts        []compare.Option
+		control     string
+		candidate   string
+		differences []experiment.Difference
+	}{
+		"member order and whitespace": {
+			control:   `{"a": 1, "b": [true, null]}`,
+			candidate: `{"b":[true,null],"a":1}`,
+		},
+		"numbers": {
+			control:   `{"a": 1, "b": 100, "c": 12345678901234567890}`,
+			candidate: `{"a": 1.0, "b": 1e2, "c": 12345678901234567890}`,
+		},
+		"large numbers": {
+			control:   `12345678901234567890`,
+			candidate: `12345678901234567891`,
+			differences: []experiment.Difference{
+				{Control: json.Number("12345678901234567890"), Candidate: json.Number("12345678901234567891")},
+			},
+		},
+		"numbers within epsilon": {
+			opts:      []compare.Option{compare.FloatEpsilon(0.01)},
+			control:   `{"price": 1.001}`,
+			candidate: `{"price": 1.002}`,
+		},
+		"changed, added and removed members": {
+			control:   `{"name": "a", "items": [{"id": 1}, {"id": 2}], "a/b": 1}`,
+			candidate: `{"name": "b", "items": [{"id": 1}], "c~d": "2"}`,
+			differences: []experiment.Difference{
+				{Path: "/a~1b", Kind: experiment.DifferenceRemoved, Control: json.Number("1")},
+				{Path: "/c~0d", Kind: experiment.DifferenceAdded, Candidate: "2"},
+				{Path: "/items/1", Kind: experiment.DifferenceRemoved, Control: map[string]interface{}{"id": json.Number("2")}},
+				{Path: "/name", Control: "a", Candidate: "b"},
+			},
+		},
+		"null is not missing": {
+			control:   `{"a": null}`,
+			candidate: `{}`,
+			differences: []experiment.Difference{
+				{Path: "/a", Kind: experiment.DifferenceRemoved},
+			},
+		},
+		"types": {
+			control:   `{"a": "1"}`,
+			candidate: `{"a": 1}`,
+			differences: []experiment.Difference{
+				{Path: "/a", Control: "1", Candidate: json.Number("1")},
+			},
+		},
+		"ignored paths": {
+			opts: []compare.Option{compare.IgnoreJSONPaths(
+				"$.request_id",
+				"$.items[*].generated_at",
+				"$['meta']",
+				"$..trace_id",
+			)},
+			control:   `{"request_id": 1, "items": [{"id": 1, "generated_at": 1}], "meta": {}, "nested": {"trace_id": 1}}`,
+			candidate: `{"request_id": 2, "items": [{"id": 1, "generated_at": 2}], "nested": {"trace_id": 2}}`,
+		},
+		"ignored index": {
+			opts:      []compare.Option{compare.IgnoreJSONPaths("$.items[1]")},
+			control:   `{"items": [1, 2]}`,
+			candidate: `{"items": [1, 3]}`,
+		},
+		"invalid json": {
+			control:   `{"a": 1}`,
+			candidate: `{"a": 1`,
+			differences: []experiment.Difference{
+				{Control: `{"a": 1}`, Candidate: `{"a": 1`},
+			},
+		},
+		"trailing data": {
+			control:   `{"a": 1}`,
+			candidate: `{"a": 1} {}`,
+			differences: []experiment.Difference{
+				{Control: `{"a": 1}`, Candidate: `{"a": 1} {}`},
+			},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			c := compare.JSON[string](tc.opts...).Compare(tc.control, tc.candidate)
+			if c.Match != (len(tc.differences) == 0) {
+				t.Errorf("Expected match to be %t, got %t", len(tc.differences) == 0, c.Match)
+			}
+
+			if !reflect.DeepEqual(c.Differences, tc.differences) {
+				t.Errorf("Expected differences %+v, got %+v", tc.differences, c.Differences)
+			}
+		})
+	}
+}
+
+func TestJSON_Bytes(t *testing.T) {
+	c := compare.JSON[[]byte]().Compare([]byte(`{"a": 1}`), []byte(`{"a":1.0}`))
+	if !c.Match {
+		t.Errorf("Expected the values to match, got %+v", c.Differences)
+	}
+}
+
+func TestIgnoreJSONPaths_Invalid(t *testing.T) {
+	for _, expr := range []string{"$.", "$[0", "$[abc]", "$a"} {
+		t.Run(expr, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected IgnoreJSONPaths to panic")
+				}
+			}()
+
+			compare.IgnoreJSONPaths(expr)
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package compare
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPath represents a parsed JSONPath expression, e.g. `$.items[*].id` or
+// `$..request_id`.
+type jsonPath []segment
+
+// segment represents a single step of a JSONPath expression. It matches a
+// member name or array index, or anything when it's a wildcard. A recursive
+// segment matches at any depth below the previous segment.
+type segment struct {
+	name      string
+	wildcard  bool
+	recursive bool
+}
+
+// parseJSONPath parses the subset of JSONPath that selects members and array
+// elements: `$`, `.name`, `['name']`, `[0]`, `.*`, `[*]` and `..name`.
+func parseJSONPath(expr string) (jsonPath, error) {
+	s := strings.TrimPrefix(expr, "$")
+
+	var path jsonPath
+	for len(s) > 0 {
+		var seg segment
+		switch {
+		case strings.HasPrefix(s, ".."):
+			seg.recursive = true
+			s = s[2:]
+			if strings.HasPrefix(s, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(s, "."):
+			s = strings.TrimPrefix(s, ".")
+			end := strings.IndexAny(s, ".[")
+			if end < 0 {
+				end = len(s)
+			}
+
+			seg.name, s = s[:end], s[end:]
+			if seg.name == "" {
+				return nil, fmt.Errorf("compare: empty member name in JSONPath %q", expr)
+			}
+			seg.wildcard = seg.name == "*"
+			path = append(path, seg)
+			continue
+		case !strings.HasPrefix(s, "["):
+			return nil, fmt.Errorf("compare: unexpected %q in JSONPath %q", s, expr)
+		}
+
+		end := strings.Index(s, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("compare: unterminated bracket in JSONPath %q", expr)
+		}
+
+		name := s[1:end]
+		s = s[end+1:]
+		switch {
+		case name == "*":
+			seg.wildcard = true
+		case len(name) >= 2 && (name[0] == '\'' || name[0] == '"') && name[len(name)-1] == name[0]:
+			seg.name = name[1 : len(name)-1]
+		default:
+			if _, err := strconv.Atoi(name); err != nil {
+				return nil, fmt.Errorf("compare: invalid index %q in JSONPath %q", name, expr)
+			}
+			seg.name = name
+		}
+
+		path = append(path, seg)
+	}
+
+	return path, nil
+}
+
+// match reports whether the path, a list of member names and array indexes,
+// is selected by the expression.
+func (p jsonPath) match(path []string) bool {
+	if len(p) == 0 {
+		return len(path) == 0
+	}
+
+	seg := p[0]
+	if seg.recursive {
+		for i := range path {
+			if seg.matches(path[i]) && p[1:].match(path[i+1:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return len(path) > 0 && seg.matches(path[0]) && p[1:].match(path[1:])
+}
+
+func (s segment) matches(name string) bool {
+	return s.wildcard || s.name == name
+}
@@ -0,0 +1,217 @@
+package compare
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Option configures how a comparator compares values. Options that don't apply
+// to a comparator are ignored by it.
+type Option func(*options)
+
+type options struct {
+	ignorePaths    []string
+	ignoreTags     []tag
+	epsilon        float64
+	timeTolerance  time.Duration
+	nilEqualsEmpty bool
+	unordered      []string
+	keys           []keyer
+	jsonPaths      []jsonPath
+}
+
+type tag struct {
+	key   string
+	value string
+}
+
+// keyer extracts the key of the elements of the slices at path. It returns
+// false when the element is not of the type the key function expects.
+type keyer struct {
+	path string
+	fnc  func(interface{}) (interface{}, bool)
+}
+
+// IgnorePaths ignores the values at the given paths, together with everything
+// they hold. Paths are written like the paths of the differences, e.g.
+// `.User.UpdatedAt`, `.Items[0]` or `.Labels["team"]`. A `*` matches any
+// field, index or key, e.g. `.Items[*].ID`.
+func IgnorePaths(paths ...string) Option {
+	return func(o *options) {
+		o.ignorePaths = append(o.ignorePaths, paths...)
+	}
+}
+
+// IgnoreTag ignores the struct fields which have the given value for the
+// struct tag key, e.g. IgnoreTag("experiment", "ignore") ignores fields
+// tagged with `experiment:"ignore"`. Values with multiple comma separated
+// options match when any of the options is the given value.
+func IgnoreTag(key, value string) Option {
+	return func(o *options) {
+		o.ignoreTags = append(o.ignoreTags, tag{key: key, value: value})
+	}
+}
+
+// FloatEpsilon considers floats equal when they differ by at most epsilon. A NaN
+// is never within the epsilon.
+func FloatEpsilon(epsilon float64) Option {
+	return func(o *options) {
+		o.epsilon = epsilon
+	}
+}
+
+// TimeTolerance considers times equal when they differ by at most the given
+// duration. Without a tolerance, times are equal when they represent the same
+// instant, regardless of their location.
+func TimeTolerance(d time.Duration) Option {
+	return func(o *options) {
+		o.timeTolerance = d
+	}
+}
+
+// NilEqualsEmpty considers nil slices and maps equal to empty ones.
+func NilEqualsEmpty() Option {
+	return func(o *options) {
+		o.nilEqualsEmpty = true
+	}
+}
+
+// Unordered compares the slices and arrays at the given paths as multisets,
+// the order of their elements doesn't matter. Without paths, all slices and
+// arrays are compared as multisets. Elements that are only present on one
+// side are reported as added or removed, at their index on that side.
+func Unordered(paths ...string) Option {
+	return func(o *options) {
+		if len(paths) == 0 {
+			paths = []string{"*"}
+		}
+
+		o.unordered = append(o.unordered, paths...)
+	}
+}
+
+// KeyBy matches the elements of the slices and arrays at the given path by the
+// key fnc returns, regardless of their order. Differences are reported at the
+// key of the element, e.g. `.Items[42].Name`, and elements of which the key is
+// only present on one side are reported as added or removed. Elements sharing
+// a key are paired in order, and the ones left over are reported as added or
+// removed as well. When an element is not of type T, the slice is compared by
+// index.
+func KeyBy[T any, K comparable](path string, fnc func(T) K) Option {
+	return func(o *options) {
+		o.keys = append(o.keys, keyer{
+			path: path,
+			fnc: func(v interface{}) (interface{}, bool) {
+				t, ok := v.(T)
+				if !ok {
+					return nil, false
+				}
+
+				return fnc(t), true
+			},
+		})
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// ignoredField reports whether the struct field is ignored by its tags.
+func (o *options) ignoredField(f reflect.StructField) bool {
+	for _, t := range o.ignoreTags {
+		value, ok := f.Tag.Lookup(t.key)
+		if !ok {
+			continue
+		}
+
+		for _, v := range strings.Split(value, ",") {
+			if v == t.value {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ignoredPath reports whether the path is ignored by one of the paths.
+func (o *options) ignoredPath(path string) bool {
+	return anyPath(o.ignorePaths, path)
+}
+
+// unorderedPath reports whether the slice at path is compared as a multiset.
+func (o *options) unorderedPath(path string) bool {
+	for _, p := range o.unordered {
+		if p == "*" {
+			return true
+		}
+	}
+
+	return anyPath(o.unordered, path)
+}
+
+// keyer returns the key function for the slice at path, if any.
+func (o *options) keyer(path string) (keyer, bool) {
+	for _, k := range o.keys {
+		if matchPath(split(k.path), split(path)) {
+			return k, true
+		}
+	}
+
+	return keyer{}, false
+}
+
+func anyPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if matchPath(split(p), split(path)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPath(pattern, path []string) bool {
+	if len(pattern) != len(path) {
+		return false
+	}
+
+	for i := range pattern {
+		if pattern[i] != path[i] && pattern[i] != ".*" && pattern[i] != "[*]" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// split splits a path into its segments, e.g. `.Items[0].ID` into `.Items`,
+// `[0]` and `.ID`. Brackets within quoted keys don't start a new segment.
+func split(path string) []string {
+	var segments []string
+	var quoted bool
+	start := 0
+	for i := 0; i < len(path); i++ {
+		switch c := path[i]; {
+		case c == '"' && (i == 0 || path[i-1] != '\\'):
+			quoted = !quoted
+		case quoted:
+		case (c == '.' || c == '[') && i > start:
+			segments = append(segments, path[start:i])
+			start = i
+		}
+	}
+
+	if start < len(path) {
+		segments = append(segments, path[start:])
+	}
+
+	return segments
+}
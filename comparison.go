@@ -0,0 +1,73 @@
+package experiment
+
+// Comparator represents the comparison functionality between a control and a
+// candidate which describes what differs between them. It will only be called
+// for candidates that did not error.
+type Comparator[C any] interface {
+	Compare(control, candidate C) Comparison
+}
+
+// ComparatorFunc is a function that implements Comparator.
+type ComparatorFunc[C any] func(control, candidate C) Comparison
+
+// Compare calls the function.
+func (f ComparatorFunc[C]) Compare(control, candidate C) Comparison {
+	return f(control, candidate)
+}
+
+// Compare implements Comparator for a CompareFunc. The Comparison only tells
+// whether the values match.
+func (f CompareFunc[C]) Compare(control, candidate C) Comparison {
+	return Comparison{Match: f(control, candidate)}
+}
+
+// Comparison represents the outcome of comparing a candidate against the
+// control.
+// Score is an optional similarity between 0, nothing in common, and 1, equal.
+// It's nil when the comparator doesn't score.
+type Comparison struct {
+	Match       bool
+	Score       *float64
+	Differences []Difference
+}
+
+// Difference represents a single difference between the control and a
+// candidate. Path describes where the difference is, e.g. a field or index,
+// and is empty when the values differ as a whole.
+// Kind tells whether the value changed, or is only present on one side.
+type Difference struct {
+	Path      string
+	Kind      DifferenceKind
+	Control   interface{}
+	Candidate interface{}
+}
+
+// DifferenceKind describes how a value differs between the control and a
+// candidate.
+type DifferenceKind int
+
+const (
+	// DifferenceChanged means both have a value, but the values differ.
+	DifferenceChanged DifferenceKind = iota
+
+	// DifferenceAdded means only the candidate has a value, e.g. an element
+	// or key which the control doesn't have.
+	DifferenceAdded
+
+	// DifferenceRemoved means only the control has a value.
+	DifferenceRemoved
+)
+
+// String returns a readable representation of the kind.
+func (k DifferenceKind) String() string {
+	switch k {
+	case DifferenceChanged:
+		return "changed"
+	case DifferenceAdded:
+		return "added"
+	case DifferenceRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
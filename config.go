@@ -1,30 +1,133 @@
 package experiment
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
 // Config represents the configuration options for an experiment.
 type Config struct {
-	Percentage  int
-	Concurrency bool
-	Timeout     *time.Duration
+	Name              string
+	Sampler           Sampler
+	RateLimiters      []*RateLimiter
+	Percentage        float64
+	SampleKey         *string
+	Salt              string
+	Concurrency       bool
+	Detached          bool
+	Timeout           *time.Duration
+	ControlTimeout    *time.Duration
+	Executor          *Executor
+	Breaker           *CircuitBreaker
+	ControlPanicError bool
+	ServeCandidate    string
+	ServeSampler      Sampler
+	FallbackCandidate string
+	FallbackPolicy    FallbackPolicy
+	CompareCleaned    bool
+	PublishTimeout    *time.Duration
 }
 
 // ConfigFunc represents a function that knows how to set a configuration option.
 type ConfigFunc func(*Config)
 
-// WithPercentage returns a new func(*Config) that sets the percentage.
+// WithPercentage returns a new func(*Config) that sets the percentage. It
+// panics if the percentage is not between 0 and 100.
 func WithPercentage(p int) ConfigFunc {
+	if err := validatePercentage(float64(p)); err != nil {
+		panic(err)
+	}
+
+	return func(c *Config) {
+		c.Percentage = float64(p)
+	}
+}
+
+// WithFractionalPercentage sets a percentage which can be smaller than 1, like
+// 0.05 to sample one in every 2000 runs. It panics if the percentage is not
+// between 0 and 100.
+func WithFractionalPercentage(p float64) ConfigFunc {
+	if err := validatePercentage(p); err != nil {
+		panic(err)
+	}
+
 	return func(c *Config) {
 		c.Percentage = p
 	}
 }
 
+// WithName sets the name of the experiment. The name is passed on to the
+// Sampler and is used as salt when no salt is configured.
+func WithName(name string) ConfigFunc {
+	return func(c *Config) {
+		c.Name = name
+	}
+}
+
+// WithSampler decides whether the candidates should run through the given
+// sampler. The percentage and sample key are not used when a sampler is set.
+// It panics if the sampler is a PercentageSampler which is not between 0 and
+// 100.
+func WithSampler(s Sampler) ConfigFunc {
+	mustValidateSampler(s)
+
+	return func(c *Config) {
+		c.Sampler = s
+	}
+}
+
+// WithMaxRunsPerSecond caps how often the candidates run to perSecond runs
+// every second on average, with bursts of up to burst runs. The cap applies on
+// top of the percentage or sampler. Like NewRateLimiter, it panics if
+// perSecond is not above 0 or burst is less than 1.
+func WithMaxRunsPerSecond(perSecond float64, burst int) ConfigFunc {
+	return WithRateLimiter(NewRateLimiter(perSecond, burst))
+}
+
+// WithRateLimiter caps how often the candidates run through the given rate
+// limiter. Share a rate limiter between experiments to give them a single
+// budget. The cap applies on top of the percentage, sampler and other rate
+// limiters.
+func WithRateLimiter(l *RateLimiter) ConfigFunc {
+	return func(c *Config) {
+		c.RateLimiters = append(c.RateLimiters, l)
+	}
+}
+
+// WithSampleKey makes the sampling decision sticky for the given key, like a
+// user or tenant ID. Runs with the same key and salt are either all sampled or
+// all skipped.
+func WithSampleKey(key string) ConfigFunc {
+	return func(c *Config) {
+		c.SampleKey = &key
+	}
+}
+
+// WithSalt sets the salt that is hashed together with the sample key. Use a
+// different salt per experiment so that the same keys don't end up in every
+// experiment. It defaults to the name of the experiment.
+func WithSalt(salt string) ConfigFunc {
+	return func(c *Config) {
+		c.Salt = salt
+	}
+}
+
+// WithTimeout sets the timeout of the candidates. The control keeps the
+// deadline of the context passed to Run, unless WithControlTimeout is given.
 func WithTimeout(t time.Duration) ConfigFunc {
 	return func(c *Config) {
 		c.Timeout = &t
 	}
 }
 
+// WithControlTimeout sets the timeout of the control.
+func WithControlTimeout(t time.Duration) ConfigFunc {
+	return func(c *Config) {
+		c.ControlTimeout = &t
+	}
+}
+
 // WithConcurrency forces the experiment to run concurrently
 func WithConcurrency() ConfigFunc {
 	return func(c *Config) {
@@ -32,6 +135,124 @@ func WithConcurrency() ConfigFunc {
 	}
 }
 
+// WithDetachedCandidates detaches the candidates from the cancellation and
+// deadline of the context given to Run. The candidates keep the values of the
+// context and are only bounded by their own timeout. The control and a
+// candidate that is served from are not detached.
+func WithDetachedCandidates() ConfigFunc {
+	return func(c *Config) {
+		c.Detached = true
+	}
+}
+
+// WithExecutor runs the candidates on the given executor instead of starting a
+// new goroutine for every candidate. Only experiments with an executor are
+// waited for by Executor.Shutdown.
+func WithExecutor(x *Executor) ConfigFunc {
+	return func(c *Config) {
+		c.Executor = x
+	}
+}
+
+// WithCircuitBreaker skips candidates that fail too often, according to the
+// given circuit breaker. The control is never skipped.
+func WithCircuitBreaker(cb *CircuitBreaker) ConfigFunc {
+	return func(c *Config) {
+		c.Breaker = cb
+	}
+}
+
+// WithServeCandidate serves the runs selected by the sampler from the named
+// candidate instead of the control. The control still runs as a shadow and is
+// compared against the candidate. When the candidate returns an error or
+// panics, the result of the control is served instead. The other candidates
+// only run when the run is sampled as well. Use a DynamicSampler to ramp up the
+// share of runs served from the candidate. Like WithSampler, it panics on an
+// invalid PercentageSampler.
+func WithServeCandidate(name string, s Sampler) ConfigFunc {
+	mustValidateSampler(s)
+
+	return func(c *Config) {
+		c.ServeCandidate = name
+		c.ServeSampler = s
+	}
+}
+
+// FallbackPolicy decides which errors of the control make a run fall back to
+// the result of a candidate.
+type FallbackPolicy int
+
+const (
+	// FallbackOnError falls back when the control returns an error, unless
+	// the error is a timeout.
+	FallbackOnError FallbackPolicy = iota
+
+	// FallbackOnErrorOrTimeout falls back when the control returns an error,
+	// including timeouts.
+	FallbackOnErrorOrTimeout
+)
+
+// WithControlFallback returns the result of the named candidate when the
+// control returns an error according to the policy, and the candidate ran in
+// the same run without an error. Panics of the control never fall back.
+func WithControlFallback(name string, policy FallbackPolicy) ConfigFunc {
+	return func(c *Config) {
+		c.FallbackCandidate = name
+		c.FallbackPolicy = policy
+	}
+}
+
+// fallsBack reports whether the error of the control should fall back to the
+// result of a candidate.
+func (c *Config) fallsBack(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if _, ok := err.(ControlPanicError); ok {
+		return false
+	}
+
+	return c.FallbackPolicy == FallbackOnErrorOrTimeout || !errors.Is(err, context.DeadlineExceeded)
+}
+
+// DefaultPublishTimeout is the time the observations of a concurrent run may
+// take to publish when no publish timeout is configured.
+const DefaultPublishTimeout = 10 * time.Second
+
+// WithPublishTimeout sets the time the observations of a concurrent run may
+// take to publish. These are published in the background, from a context that
+// keeps the values of the context given to Run but not its cancellation.
+func WithPublishTimeout(d time.Duration) ConfigFunc {
+	return func(c *Config) {
+		c.PublishTimeout = &d
+	}
+}
+
+func (c *Config) publishTimeout() time.Duration {
+	if c.PublishTimeout == nil {
+		return DefaultPublishTimeout
+	}
+
+	return *c.PublishTimeout
+}
+
+// WithCompareCleaned compares the clean values of the control and candidates,
+// instead of the values they returned.
+func WithCompareCleaned() ConfigFunc {
+	return func(c *Config) {
+		c.CompareCleaned = true
+	}
+}
+
+// WithControlPanicError returns a panic of the control as a ControlPanicError
+// from Run, instead of raising the panic again.
+func WithControlPanicError() ConfigFunc {
+	return func(c *Config) {
+		c.ControlPanicError = true
+	}
+}
+
 // WithDefaultConfig returns a new configuration with defaults.
 func WithDefaultConfig() ConfigFunc {
 	return func(c *Config) {
@@ -39,3 +260,90 @@ func WithDefaultConfig() ConfigFunc {
 		c.Concurrency = false
 	}
 }
+
+// CandidateConfig represents the configuration of a single candidate. It
+// defaults to the configuration of the experiment and is recorded on the
+// observation of the candidate.
+type CandidateConfig struct {
+	Timeout     *time.Duration
+	Percentage  float64
+	Concurrency bool
+}
+
+// CandidateOption represents a function that knows how to set a configuration
+// option of a candidate.
+type CandidateOption func(*CandidateConfig)
+
+// WithCandidateTimeout sets the timeout of the candidate, overriding the
+// timeout of the experiment.
+func WithCandidateTimeout(t time.Duration) CandidateOption {
+	return func(c *CandidateConfig) {
+		c.Timeout = &t
+	}
+}
+
+// WithCandidatePercentage sets the percentage of the sampled runs in which the
+// candidate runs. It panics if the percentage is not between 0 and 100.
+func WithCandidatePercentage(p float64) CandidateOption {
+	if err := validatePercentage(p); err != nil {
+		panic(err)
+	}
+
+	return func(c *CandidateConfig) {
+		c.Percentage = p
+	}
+}
+
+// WithCandidateConcurrency sets whether the candidate may run concurrently,
+// overriding the concurrency of the experiment. A candidate which may not run
+// concurrently runs before Run returns, one at a time with the control and
+// other candidates that may not run concurrently.
+func WithCandidateConcurrency(concurrent bool) CandidateOption {
+	return func(c *CandidateConfig) {
+		c.Concurrency = concurrent
+	}
+}
+
+// RunOption represents a function that knows how to set an option of a single
+// run of a Definition.
+type RunOption func(*runOptions)
+
+// runOptions represents the options of a single run.
+type runOptions struct {
+	force     bool
+	ignore    bool
+	sampleKey *string
+}
+
+// WithRunForce makes the candidates run, regardless of the percentage, sampler
+// and rate limiters. WithRunIgnore takes precedence over it.
+func WithRunForce(f bool) RunOption {
+	return func(o *runOptions) {
+		o.force = f
+	}
+}
+
+// WithRunIgnore makes only the control run.
+func WithRunIgnore(i bool) RunOption {
+	return func(o *runOptions) {
+		o.ignore = i
+	}
+}
+
+// WithRunSampleKey makes the sampling decision of the run sticky for the given
+// key, like the ID of the user making a request, overriding WithSampleKey. Like
+// WithSampleKey, it applies to the configured percentage and not to a Sampler.
+func WithRunSampleKey(key string) RunOption {
+	return func(o *runOptions) {
+		o.sampleKey = &key
+	}
+}
+
+func newRunOptions(opts []RunOption) runOptions {
+	var o runOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
@@ -0,0 +1,90 @@
+package experiment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+)
+
+// RunInfo describes the run of an experiment a control or candidate is part
+// of. It's available from the context passed to the control and candidates.
+type RunInfo struct {
+	// Experiment is the name of the experiment.
+	Experiment string
+
+	// Candidate is the name of the control or candidate the context was passed
+	// to. It's empty outside of the control and candidates, e.g. in the Before
+	// function.
+	Candidate string
+
+	// RunID identifies the run, it's shared by the control and all candidates
+	// of the same run.
+	RunID string
+
+	// Shadow is true when the result is not going to be returned, e.g. for
+	// candidates and for the control when serving from a candidate. Code with
+	// side effects can use this to skip or sandbox them.
+	Shadow bool
+}
+
+type runInfoKey struct{}
+
+// FromContext returns the RunInfo of the experiment run the context belongs
+// to. It returns false when the context doesn't belong to an experiment run.
+func FromContext(ctx context.Context) (RunInfo, bool) {
+	info, ok := ctx.Value(runInfoKey{}).(RunInfo)
+	return info, ok
+}
+
+// IsShadow reports whether the context was passed to a control or candidate of
+// which the result is not going to be returned.
+func IsShadow(ctx context.Context) bool {
+	info, _ := FromContext(ctx)
+	return info.Shadow
+}
+
+func withRunInfo(ctx context.Context, info RunInfo) context.Context {
+	return context.WithValue(ctx, runInfoKey{}, info)
+}
+
+// withCandidate returns a context for the named control or candidate within
+// the run the context belongs to.
+func withCandidate(ctx context.Context, name string, shadow bool) context.Context {
+	info, _ := FromContext(ctx)
+	info.Candidate = name
+	info.Shadow = shadow
+
+	return withRunInfo(ctx, info)
+}
+
+func newRunID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b[:])
+}
+
+// detachedContext keeps the values of its parent, but is never cancelled and
+// has no deadline.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
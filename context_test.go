@@ -0,0 +1,76 @@
+package experiment_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestFromContext(t *testing.T) {
+	ctx := context.Background()
+	if _, ok := experiment.FromContext(ctx); ok {
+		t.Errorf("Expected no run info outside of an experiment")
+	}
+
+	run := func(cfg ...experiment.ConfigFunc) map[string]experiment.RunInfo {
+		var lock sync.Mutex
+		infos := map[string]experiment.RunInfo{}
+		record := func(ctx context.Context, _ int) (string, error) {
+			info, ok := experiment.FromContext(ctx)
+			if !ok {
+				t.Errorf("Expected run info in the context")
+			}
+
+			if info.Shadow != experiment.IsShadow(ctx) {
+				t.Errorf("Expected IsShadow to match the run info")
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			infos[info.Candidate] = info
+
+			return info.Candidate, nil
+		}
+
+		def := experiment.NewDefinition[int, string](append(cfg, experiment.WithName("ctx"), experiment.WithPercentage(100))...)
+		def.Control(record)
+		def.Candidate("rewrite", record)
+
+		if err := def.Run(ctx, 1).Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		return infos
+	}
+
+	t.Run("it should describe the run", func(t *testing.T) {
+		infos := run(experiment.WithConcurrency())
+
+		control, candidate := infos["control"], infos["rewrite"]
+		if control.Experiment != "ctx" || candidate.Experiment != "ctx" {
+			t.Errorf("Expected the experiment name, got '%s' and '%s'", control.Experiment, candidate.Experiment)
+		}
+
+		if control.RunID == "" || control.RunID != candidate.RunID {
+			t.Errorf("Expected a shared run ID, got '%s' and '%s'", control.RunID, candidate.RunID)
+		}
+
+		if control.Shadow || !candidate.Shadow {
+			t.Errorf("Expected only the candidate to be a shadow")
+		}
+
+		if other := run()["control"]; other.RunID == control.RunID {
+			t.Errorf("Expected every run to have its own run ID")
+		}
+	})
+
+	t.Run("it should mark the control as shadow when serving from a candidate", func(t *testing.T) {
+		infos := run(experiment.WithServeCandidate("rewrite", experiment.PercentageSampler(100)))
+
+		if !infos["control"].Shadow || infos["rewrite"].Shadow {
+			t.Errorf("Expected only the control to be a shadow")
+		}
+	})
+}
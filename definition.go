@@ -0,0 +1,835 @@
+package experiment
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// DefinitionFunc represents a function that is implemented by the control or a
+// candidate of a Definition. It receives the input of the run. The value
+// returned is the value that will be used to compare data.
+type DefinitionFunc[I, C any] func(context.Context, I) (C, error)
+
+// candidate holds a candidate function, control included, together with its
+// resolved configuration.
+type candidate[I, C any] struct {
+	fnc    DefinitionFunc[I, C]
+	config CandidateConfig
+}
+
+// Definition represents an experiment which is defined once, for example at
+// startup, and run many times with a different input. Once the control and
+// candidates have been defined, a Definition is safe to run from multiple
+// goroutines. Every run returns its own Result.
+// Definition is a MappedDefinition of which the observations hold values of the
+// same type as the candidates return.
+type Definition[I, C any] struct {
+	*MappedDefinition[I, C, C]
+}
+
+// NewDefinition creates a new Definition with the given configuration options.
+func NewDefinition[I, C any](cfgs ...ConfigFunc) *Definition[I, C] {
+	return &Definition[I, C]{
+		MappedDefinition: newMappedDefinition[I, C, C](func(c C) C { return c }, cfgs),
+	}
+}
+
+// WithPublisher configures the publisher for the definition. The publisher must
+// have the same type associated as the definition.
+func (d *Definition[I, C]) WithPublisher(pub Publisher[C]) *Definition[I, C] {
+	d.MappedDefinition.WithPublisher(pub)
+	return d
+}
+
+// Clean will cleanup the state of a candidate (control included). This is done
+// so the state could be cleaned up before storing for later comparison.
+func (d *Definition[I, C]) Clean(fnc CleanFunc[C]) {
+	d.clean = MapFunc[C, C](fnc)
+}
+
+// Run runs the control and, when sampled, the candidates with the given input.
+// See MappedDefinition.Run.
+func (d *Definition[I, C]) Run(ctx context.Context, in I, opts ...RunOption) *Result[C] {
+	return &Result[C]{MappedResult: *d.MappedDefinition.Run(ctx, in, opts...)}
+}
+
+// MappedDefinition represents a Definition of which the candidates return
+// values of type C, while their observations hold values of type D. Every value
+// is mapped from C to D once the candidates have finished, which allows to
+// compare and publish a smaller or comparable part of large values only.
+type MappedDefinition[I, C, D any] struct {
+	config    *Config
+	publisher Publisher[D]
+
+	candidates map[string]candidate[I, C]
+
+	before  func(context.Context, I) error
+	compare Comparator[D]
+	errors  ErrorCompareFunc
+	ignores []ignoreRule[D]
+	value   MapFunc[C, D]
+	clean   MapFunc[C, D]
+
+	inFlight atomic.Int64
+}
+
+// NewMappedDefinition creates a new MappedDefinition which maps the values of
+// the control and candidates with fnc, with the given configuration options.
+// The mapped value is stored in both the Value and CleanValue of the
+// observations.
+func NewMappedDefinition[I, C, D any](fnc MapFunc[C, D], cfgs ...ConfigFunc) *MappedDefinition[I, C, D] {
+	return newMappedDefinition[I](fnc, cfgs)
+}
+
+func newMappedDefinition[I, C, D any](fnc MapFunc[C, D], cfgs []ConfigFunc) *MappedDefinition[I, C, D] {
+	cfg := &Config{}
+	for _, c := range cfgs {
+		c(cfg)
+	}
+
+	return &MappedDefinition[I, C, D]{
+		config:     cfg,
+		candidates: map[string]candidate[I, C]{},
+		value:      fnc,
+	}
+}
+
+// WithPublisher configures the publisher for the definition. The publisher must
+// have the mapped type associated.
+func (d *MappedDefinition[I, C, D]) WithPublisher(pub Publisher[D]) *MappedDefinition[I, C, D] {
+	d.publisher = pub
+	return d
+}
+
+// Before filter to do expensive setup only when the candidates are going to
+// run. It receives the input of the run.
+func (d *MappedDefinition[I, C, D]) Before(fnc func(context.Context, I) error) {
+	d.before = fnc
+}
+
+// Control represents the control function, this resembles the old or current
+// implementation. This function will always run, regardless of the
+// configuration percentage.
+func (d *MappedDefinition[I, C, D]) Control(fnc DefinitionFunc[I, C]) {
+	d.candidates["control"] = candidate[I, C]{
+		fnc: fnc,
+		config: CandidateConfig{
+			Timeout:    d.config.ControlTimeout,
+			Percentage: 100,
+		},
+	}
+}
+
+// Candidate represents a refactoring solution. The options override the
+// configuration of the definition for this candidate.
+// If the name is control, this will panic.
+func (d *MappedDefinition[I, C, D]) Candidate(name string, fnc DefinitionFunc[I, C], opts ...CandidateOption) error {
+	if name == "control" {
+		panic("can't use a candidate with the name 'control'")
+	}
+
+	cfg := CandidateConfig{
+		Timeout:     d.config.Timeout,
+		Percentage:  100,
+		Concurrency: d.config.Concurrency,
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	d.candidates[name] = candidate[I, C]{
+		fnc:    fnc,
+		config: cfg,
+	}
+	return nil
+}
+
+// Compare represents the comparison functionality between a control and a
+// candidate. It compares the values of the observations, or their clean
+// values when the WithCompareCleaned configuration is given.
+func (d *MappedDefinition[I, C, D]) Compare(fnc CompareFunc[D]) {
+	if fnc == nil {
+		d.compare = nil
+		return
+	}
+
+	d.compare = fnc
+}
+
+// CompareWith represents the comparison functionality between a control and a
+// candidate, like Compare, of which the Comparison is recorded on the
+// observation of the candidate.
+func (d *MappedDefinition[I, C, D]) CompareWith(c Comparator[D]) {
+	d.compare = c
+}
+
+// IgnoreMismatch registers a named rule which accepts known mismatches. When a
+// candidate did not match the control, or failed, the rules are called in the
+// order they were registered. The observation of the candidate is marked as
+// ignored with the name of the first rule that returns true. It keeps its
+// Success and Mismatch fields, but is counted separately from real mismatches.
+// This is not safe to call while the definition is running.
+func (d *MappedDefinition[I, C, D]) IgnoreMismatch(name string, fnc IgnoreFunc[D]) {
+	d.ignores = append(d.ignores, ignoreRule[D]{name: name, fnc: fnc})
+}
+
+// ignoreRule represents a named IgnoreFunc.
+type ignoreRule[D any] struct {
+	name string
+	fnc  IgnoreFunc[D]
+}
+
+// CompareErrors represents the comparison functionality between the errors of
+// a control and a candidate. Once given, the errors are compared when both
+// returned one, and a candidate that returns the same error as the control is
+// a match. When only one of them returned an error, the candidate is a
+// mismatch of the ControlErrored or CandidateErrored kind.
+func (d *MappedDefinition[I, C, D]) CompareErrors(fnc ErrorCompareFunc) {
+	d.errors = fnc
+}
+
+// Run runs the control and, when sampled, the candidates with the given input.
+// The options apply to this run only, e.g. to force or ignore it, or to sample
+// it by the user making a request.
+// The value and error of the control are available on the Result straight
+// away.
+// The control runs on the calling goroutine, unless the run is served from a
+// candidate. The control then runs as a shadow on a goroutine of its own. If
+// the control panics and its result is returned, the panic is raised again
+// from Run with its original value, unless the WithControlPanicError
+// configuration is given.
+// The observations are published automatically once all candidates have
+// finished. If the concurrency configuration is given, this happens in the
+// background. Use Wait on the Result to block until that has happened.
+func (d *MappedDefinition[I, C, D]) Run(ctx context.Context, in I, opts ...RunOption) *MappedResult[C, D] {
+	return d.raise(d.run(ctx, in, d.decide(ctx, newRunOptions(opts)), true))
+}
+
+// decision represents whether a run samples the candidates and whether it is
+// served from the candidate configured with WithServeCandidate.
+type decision struct {
+	sample bool
+	serve  bool
+}
+
+// decide decides how to run. Serving from a candidate is decided apart from
+// sampling: a run which is served but not sampled only runs the served
+// candidate, with the control as its shadow.
+func (d *MappedDefinition[I, C, D]) decide(ctx context.Context, opts runOptions) decision {
+	switch {
+	case opts.ignore:
+		return decision{}
+	case opts.force:
+		return decision{sample: true, serve: d.serve(ctx)}
+	}
+
+	return decision{sample: d.sample(ctx, opts.sampleKey), serve: d.serve(ctx)}
+}
+
+// sample decides whether the candidates should run according to the configured
+// sampler, percentage and rate limiters.
+func (d *MappedDefinition[I, C, D]) sample(ctx context.Context, key *string) bool {
+	var sampled bool
+	if d.config.Sampler != nil {
+		sampled = d.config.Sampler.Sample(ctx, d.config.Name)
+	} else {
+		sampled = d.config.sample(key)
+	}
+
+	return sampled && d.config.allow()
+}
+
+// serve decides whether the run should be served from a candidate.
+func (d *MappedDefinition[I, C, D]) serve(ctx context.Context) bool {
+	if d.config.ServeSampler == nil {
+		return false
+	}
+
+	if _, ok := d.candidates[d.config.ServeCandidate]; !ok {
+		return false
+	}
+
+	return d.config.ServeSampler.Sample(ctx, d.config.Name)
+}
+
+// run runs the definition. When the concurrency configuration is not given,
+// the observations are only published if publish is true. A panic of the
+// control is returned as the error of the Result.
+func (d *MappedDefinition[I, C, D]) run(ctx context.Context, in I, dec decision, publish bool) *MappedResult[C, D] {
+	ctx = withRunInfo(ctx, RunInfo{Experiment: d.config.Name, RunID: newRunID()})
+
+	// don't run the candidates, just the control
+	if !(dec.sample || dec.serve) || !d.begin() {
+		control := d.runControl(ctx, in, false)
+		control.Served = true
+
+		return d.result(control, nil)
+	}
+
+	if d.before != nil {
+		if err := d.before(ctx, in); err != nil {
+			d.end()
+			return &MappedResult[C, D]{Error: err, Sampled: true}
+		}
+	}
+
+	ex := &execution[C, D]{
+		raw:  map[string]*Observation[C]{},
+		done: make(chan struct{}),
+	}
+
+	names := d.admit(ex, dec)
+
+	var served string
+	if dec.serve && contains(names, d.config.ServeCandidate) {
+		served = d.config.ServeCandidate
+	}
+
+	var fallback string
+	if name := d.config.FallbackCandidate; name != served && contains(names, name) {
+		fallback = name
+	}
+
+	// the control and the served candidate don't run on the executor.
+	n := len(names) - 1
+	if served != "" {
+		n--
+	}
+	b := d.batch(n)
+
+	// candidates that may run concurrently are started first and collected
+	// at the end, the others run one by one together with the control. The
+	// fallback candidate gets a channel of its own, so it can be waited for
+	// when the control fails.
+	obsChan := make(chan *Observation[C], len(names))
+	var fallbackChan chan *Observation[C]
+	var background int
+	for _, name := range names {
+		c := d.candidates[name]
+		switch {
+		case name == "control" || name == served || !c.config.Concurrency:
+		case name == fallback:
+			fallbackChan = make(chan *Observation[C], 1)
+			d.start(ctx, in, name, c, b, fallbackChan)
+		default:
+			d.start(ctx, in, name, c, b, obsChan)
+			background++
+		}
+	}
+
+	// when serving from a candidate, the control runs next to it as a shadow
+	// and is only waited for when the candidate fails.
+	var controlChan chan *Observation[C]
+	if served != "" {
+		controlChan = make(chan *Observation[C], 1)
+		go func() {
+			controlChan <- d.runControl(ctx, in, true)
+		}()
+	}
+
+	seqChan := make(chan *Observation[C], 1)
+	for _, name := range names {
+		c := d.candidates[name]
+		switch {
+		case name == "control":
+			if served == "" {
+				ex.raw[name] = d.runControl(ctx, in, false)
+			}
+			continue
+		case name == served:
+			ex.raw[name] = d.runServed(ctx, in, name, c)
+			continue
+		case c.config.Concurrency:
+			continue
+		}
+
+		d.start(ctx, in, name, c, b, seqChan)
+
+		// block on waiting until there's a message in the seqChan. By doing
+		// this within the for loop, we ensure sequential operation, as this
+		// will block until the candidate is done running.
+		obs := <-seqChan
+		ex.raw[obs.Name] = obs
+	}
+
+	// fall back to the control when the served candidate failed.
+	response := ex.raw["control"]
+	if served != "" {
+		response = ex.raw[served]
+		if response.Error != nil {
+			response = <-controlChan
+			ex.raw["control"] = response
+			controlChan = nil
+		}
+	}
+
+	// fall back to a healthy candidate when the control failed.
+	if fallback != "" && response.Name == "control" && d.config.fallsBack(response.Error) {
+		candidate, ok := ex.raw[fallback]
+		if !ok {
+			candidate = <-fallbackChan
+			ex.raw[fallback] = candidate
+			fallbackChan = nil
+		}
+
+		if candidate.Error == nil {
+			response.Fallback = fallback
+			response = candidate
+		}
+	}
+
+	response.Served = true
+	res := d.result(response, ex)
+
+	collect := func() {
+		if controlChan != nil {
+			ex.raw["control"] = <-controlChan
+		}
+
+		if fallbackChan != nil {
+			obs := <-fallbackChan
+			ex.raw[obs.Name] = obs
+		}
+
+		for i := 0; i < background; i++ {
+			obs := <-obsChan
+			ex.raw[obs.Name] = obs
+		}
+
+		d.conclude(ex)
+	}
+
+	if !d.config.Concurrency {
+		// a panic of the comparators or the publisher reaches the caller, the
+		// run is finished nonetheless.
+		defer d.end()
+		defer close(ex.done)
+
+		collect()
+		if publish {
+			ex.err = d.publish(ctx, ex)
+		}
+
+		return res
+	}
+
+	// the remaining candidates are collected in the background so the result
+	// can be returned without waiting for them.
+	go func() {
+		defer d.end()
+		defer close(ex.done)
+
+		// nothing up the stack recovers a panic of the comparators or the
+		// publisher, so it is returned from Wait instead.
+		defer func() {
+			if r := recover(); r != nil {
+				ex.err = BackgroundPanicError{Panic: r, Stack: panicStack()}
+			}
+		}()
+
+		collect()
+
+		// the caller's context is usually done by now, publish from a context
+		// which keeps its values but not its cancellation.
+		publishCtx, cancel := context.WithTimeout(detachedContext{parent: ctx}, d.config.publishTimeout())
+		defer cancel()
+
+		ex.err = d.publish(publishCtx, ex)
+	}()
+
+	return res
+}
+
+func (d *MappedDefinition[I, C, D]) result(served *Observation[C], ex *execution[C, D]) *MappedResult[C, D] {
+	return &MappedResult[C, D]{
+		Value:     served.Value,
+		Error:     served.Error,
+		Sampled:   ex != nil,
+		ServedBy:  served.Name,
+		execution: ex,
+	}
+}
+
+// raise raises the original panic of the control again, unless it should be
+// returned as an error. Recovery code which checks for sentinel values, like
+// http.ErrAbortHandler, keeps working this way.
+func (d *MappedDefinition[I, C, D]) raise(r *MappedResult[C, D]) *MappedResult[C, D] {
+	if err, ok := r.Error.(ControlPanicError); ok && !d.config.ControlPanicError {
+		panic(err.Panic)
+	}
+
+	return r
+}
+
+func (d *MappedDefinition[I, C, D]) publish(ctx context.Context, ex *execution[C, D]) error {
+	publishErr := &PublishError{}
+	if d.publisher != nil {
+		for _, o := range ex.observations {
+			publishErr.append(d.publisher.Publish(ctx, *o))
+		}
+
+		if pub, ok := d.publisher.(BreakerPublisher); ok {
+			for _, event := range ex.events {
+				publishErr.append(pub.PublishBreakerEvent(ctx, event))
+			}
+		}
+	}
+
+	if len(publishErr.Unwrap()) == 0 {
+		return nil
+	}
+
+	return publishErr
+}
+
+// admit returns the names of the candidates, control included, that should
+// run in a random order. Candidates that are not sampled are left out, as are
+// all but the served candidate when the run is not sampled. Candidates that
+// are skipped by the circuit breaker are recorded straight away.
+func (d *MappedDefinition[I, C, D]) admit(ex *execution[C, D], dec decision) []string {
+	names := make([]string, 0, len(d.candidates))
+	for name, c := range d.candidates {
+		if name == "control" {
+			names = append(names, name)
+			continue
+		}
+
+		// runs which are only served don't run the other candidates.
+		if !dec.sample && (!dec.serve || name != d.config.ServeCandidate) {
+			continue
+		}
+
+		if c.config.Percentage < 100 && !samplePercentage(c.config.Percentage) {
+			continue
+		}
+
+		if d.config.Breaker == nil {
+			names = append(names, name)
+			continue
+		}
+
+		ticket, allowed, event := d.config.Breaker.allow(d.config.Name, name)
+		if event != nil {
+			ex.events = append(ex.events, *event)
+		}
+
+		if !allowed {
+			ex.raw[name] = &Observation[C]{
+				Name:    name,
+				Error:   ErrCircuitOpen,
+				Skipped: true,
+			}
+			continue
+		}
+
+		if ex.tickets == nil {
+			ex.tickets = map[string]breakerTicket{}
+		}
+		ex.tickets[name] = ticket
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// InFlight returns the number of candidates of the definition which are running,
+// waiting for a worker of the executor or blocked until it has room.
+func (d *MappedDefinition[I, C, D]) InFlight() int {
+	return int(d.inFlight.Load())
+}
+
+// begin registers a run with the configured executor, so that shutting down
+// the executor waits for it. It returns false when the executor is shut down.
+func (d *MappedDefinition[I, C, D]) begin() bool {
+	return d.config.Executor == nil || d.config.Executor.begin()
+}
+
+// end marks a run registered with begin as finished.
+func (d *MappedDefinition[I, C, D]) end() {
+	if d.config.Executor != nil {
+		d.config.Executor.end()
+	}
+}
+
+// batch claims room on the configured executor for n candidates of a run. It
+// returns nil when there is no executor configured.
+func (d *MappedDefinition[I, C, D]) batch(n int) *batch {
+	if d.config.Executor == nil {
+		return nil
+	}
+
+	return d.config.Executor.batch(n)
+}
+
+// start runs the candidate in the background and sends its observation on
+// obsChan. Candidates that don't fit in the executor are skipped.
+func (d *MappedDefinition[I, C, D]) start(ctx context.Context, in I, name string, c candidate[I, C], b *batch, obsChan chan<- *Observation[C]) {
+	if d.config.Detached {
+		ctx = detachedContext{parent: ctx}
+	}
+
+	task := func() {
+		candidateCtx, cancel := contextWithTimeout(withCandidate(ctx, name, true), c.config.Timeout)
+		defer cancel()
+
+		// the candidate is no longer in flight once its observation is sent.
+		res := make(chan *Observation[C], 1)
+		runCandidate(candidateCtx, in, name, c.fnc, res)
+		d.inFlight.Add(-1)
+
+		obsChan <- <-res
+	}
+
+	if b == nil {
+		d.inFlight.Add(1)
+		go task()
+		return
+	}
+
+	skip := func(err error) {
+		d.inFlight.Add(-1)
+		obsChan <- &Observation[C]{
+			Name:    name,
+			Error:   err,
+			Skipped: true,
+		}
+	}
+
+	// a candidate waiting until the executor has room is in flight as well.
+	d.inFlight.Add(1)
+	wait, err := b.take()
+	switch {
+	case err != nil:
+		skip(err)
+	case !wait:
+		b.x.execute(task)
+	default:
+		// waiting for room must not hold up the control on the calling
+		// goroutine. The executor bounds the number of waiting candidates.
+		go func() {
+			if err := b.x.await(); err != nil {
+				skip(err)
+				return
+			}
+
+			b.x.execute(task)
+		}()
+	}
+}
+
+// conclude maps the raw observations of the run and compares them against the
+// control. The raw values are released afterwards.
+func (d *MappedDefinition[I, C, D]) conclude(ex *execution[C, D]) {
+	observations := make(map[string]*Observation[D], len(ex.raw))
+	for k, raw := range ex.raw {
+		o := &Observation[D]{
+			Duration: raw.Duration,
+			Error:    raw.Error,
+			Skipped:  raw.Skipped,
+			Served:   raw.Served,
+			Fallback: raw.Fallback,
+			Name:     raw.Name,
+			Config:   d.candidates[k].config,
+		}
+
+		if o.Error == nil {
+			o.Value = d.value(raw.Value)
+			if d.clean != nil {
+				o.CleanValue = d.clean(raw.Value)
+			} else {
+				o.CleanValue = o.Value
+			}
+		}
+
+		observations[k] = o
+	}
+
+	ex.observations = observations
+	ex.raw = nil
+
+	control := observations["control"]
+	if d.compare != nil {
+		for k, o := range observations {
+			if o.Error == nil {
+				if k == "control" {
+					o.Success = true
+					continue
+				}
+
+				var comparison Comparison
+				if d.config.CompareCleaned {
+					comparison = d.compare.Compare(control.CleanValue, o.CleanValue)
+				} else {
+					comparison = d.compare.Compare(control.Value, o.Value)
+				}
+				o.Comparison = &comparison
+				o.Success = comparison.Match
+				o.ControlValue = control.CleanValue
+
+				if !o.Success {
+					o.Mismatch = ValueMismatch
+				}
+			}
+		}
+	}
+
+	if d.errors != nil {
+		for k, o := range observations {
+			if k != "control" && !o.Skipped {
+				d.compareErrors(control, o)
+			}
+		}
+	}
+
+	// a candidate which returns the error the control expects has not failed,
+	// so the breaker records the outcomes once the errors are compared.
+	if d.config.Breaker != nil {
+		for k, ticket := range ex.tickets {
+			o := observations[k]
+			failed := o.Error != nil && !o.Success
+			if event := d.config.Breaker.record(d.config.Name, k, ticket, o.Skipped, failed); event != nil {
+				ex.events = append(ex.events, *event)
+			}
+		}
+	}
+
+	if len(d.ignores) > 0 {
+		for k, o := range observations {
+			// candidates that weren't compared have no mismatch to ignore.
+			if k != "control" && !o.Skipped && !o.Success && (o.Mismatch != NoMismatch || o.Error != nil) {
+				o.IgnoredBy = d.ignore(control, o)
+			}
+		}
+	}
+}
+
+// ignore returns the name of the first ignore rule which accepts the mismatch
+// of the candidate, or an empty string when none does.
+func (d *MappedDefinition[I, C, D]) ignore(control, o *Observation[D]) string {
+	controlValue, value := control.Value, o.Value
+	if d.config.CompareCleaned {
+		controlValue, value = control.CleanValue, o.CleanValue
+	}
+
+	for _, rule := range d.ignores {
+		if rule.fnc(controlValue, value, o.Error) {
+			return rule.name
+		}
+	}
+
+	return ""
+}
+
+// compareErrors compares the outcome of a candidate against the control when
+// either of them returned an error.
+func (d *MappedDefinition[I, C, D]) compareErrors(control, o *Observation[D]) {
+	switch {
+	case control.Error == nil && o.Error == nil:
+	case control.Error == nil:
+		o.Mismatch = CandidateErrored
+	case o.Error == nil:
+		o.Success = false
+		o.Mismatch = ControlErrored
+	default:
+		o.Success = d.errors(control.Error, o.Error)
+		if !o.Success {
+			o.Mismatch = ErrorMismatch
+		}
+	}
+}
+
+// runControl runs the control. A panic of the control is recorded as a
+// ControlPanicError on its observation.
+func (d *MappedDefinition[I, C, D]) runControl(ctx context.Context, in I, shadow bool) (obs *Observation[C]) {
+	c := d.candidates["control"]
+	ctx, cancel := contextWithTimeout(withCandidate(ctx, "control", shadow), c.config.Timeout)
+	defer cancel()
+
+	start := time.Now()
+
+	defer func() {
+		if r := recover(); r != nil {
+			end := time.Now()
+
+			obs = &Observation[C]{
+				Name: "control",
+				Error: ControlPanicError{
+					Panic: r,
+					Stack: panicStack(),
+				},
+				Duration: end.Sub(start),
+			}
+		}
+	}()
+
+	v, err := c.fnc(ctx, in)
+	end := time.Now()
+
+	return &Observation[C]{
+		Name:     "control",
+		Value:    v,
+		Error:    err,
+		Duration: end.Sub(start),
+	}
+}
+
+// runServed runs the candidate the run is served from on the calling
+// goroutine. Panics are recovered like for any other candidate.
+func (d *MappedDefinition[I, C, D]) runServed(ctx context.Context, in I, name string, c candidate[I, C]) *Observation[C] {
+	ctx, cancel := contextWithTimeout(withCandidate(ctx, name, false), c.config.Timeout)
+	defer cancel()
+
+	obsChan := make(chan *Observation[C], 1)
+	runCandidate(ctx, in, name, c.fnc, obsChan)
+
+	return <-obsChan
+}
+
+func runCandidate[I, C any](ctx context.Context, in I, name string, fnc DefinitionFunc[I, C], obsChan chan<- *Observation[C]) {
+	start := time.Now()
+
+	defer func() {
+		if r := recover(); r != nil {
+			end := time.Now()
+
+			obsChan <- &Observation[C]{
+				Name: name,
+				Error: CandidatePanicError{
+					Name:  name,
+					Panic: r,
+					Stack: panicStack(),
+				},
+				Duration: end.Sub(start),
+			}
+		}
+	}()
+
+	v, err := fnc(ctx, in)
+	end := time.Now()
+
+	obsChan <- &Observation[C]{
+		Name:     name,
+		Value:    v,
+		Error:    err,
+		Duration: end.Sub(start),
+	}
+}
+
+func contextWithTimeout(ctx context.Context, timeout *time.Duration) (context.Context, context.CancelFunc) {
+	if timeout == nil {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, *timeout)
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
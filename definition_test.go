@@ -0,0 +1,429 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestDefinition(t *testing.T) {
+	for name, cfg := range map[string][]experiment.ConfigFunc{
+		"sequential": {experiment.WithPercentage(100)},
+		"concurrent": {experiment.WithPercentage(100), experiment.WithConcurrency()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var lock sync.Mutex
+			published := map[string]int{}
+			pub := &testPublisher[string]{}
+			pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
+				lock.Lock()
+				defer lock.Unlock()
+				published[o.Name]++
+				return nil
+			}
+
+			def := testDefinition(cfg...).WithPublisher(pub)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+
+					ctx := context.Background()
+					res := def.Run(ctx, i)
+					if err := res.Wait(ctx); err != nil {
+						t.Errorf("Expected no error waiting, got %s", err)
+					}
+
+					testDefinitionResult(t, i, res)
+				}(i)
+			}
+			wg.Wait()
+
+			for _, name := range []string{"control", "correct", "mismatch"} {
+				if published[name] != 50 {
+					t.Errorf("Expected 50 published observations for '%s', got %d", name, published[name])
+				}
+			}
+		})
+	}
+
+	t.Run("it should not run the candidates when not sampled", func(t *testing.T) {
+		res := testDefinition().Run(context.Background(), 1)
+		if res.Sampled {
+			t.Errorf("Expected the run not to be sampled")
+		}
+
+		if res.Value != "1" {
+			t.Errorf("Expected value '1', got '%s'", res.Value)
+		}
+
+		if obs := res.Observations(); obs != nil {
+			t.Errorf("Expected no observations, got %d", len(obs))
+		}
+	})
+
+	t.Run("it should pass the input to Before", func(t *testing.T) {
+		def := testDefinition(experiment.WithPercentage(100))
+		expected := errors.New("before")
+		def.Before(func(_ context.Context, in int) error {
+			if in == 2 {
+				return expected
+			}
+			return nil
+		})
+
+		if res := def.Run(context.Background(), 1); res.Error != nil {
+			t.Errorf("Expected no error, got %s", res.Error)
+		}
+
+		if res := def.Run(context.Background(), 2); res.Error != expected {
+			t.Errorf("Expected error '%v', got '%v'", expected, res.Error)
+		}
+	})
+}
+
+func TestDefinition_RunOptions(t *testing.T) {
+	t.Run("it should force a run", func(t *testing.T) {
+		def := testDefinition()
+		if res := def.Run(context.Background(), 1, experiment.WithRunForce(true)); !res.Sampled {
+			t.Errorf("Expected the run to be sampled")
+		}
+
+		if res := def.Run(context.Background(), 1); res.Sampled {
+			t.Errorf("Expected the force to only apply to a single run")
+		}
+	})
+
+	t.Run("it should ignore a run", func(t *testing.T) {
+		def := testDefinition(experiment.WithPercentage(100))
+		if res := def.Run(context.Background(), 1, experiment.WithRunIgnore(true)); res.Sampled {
+			t.Errorf("Expected the run not to be sampled")
+		}
+
+		res := def.Run(context.Background(), 1, experiment.WithRunForce(true), experiment.WithRunIgnore(true))
+		if res.Sampled {
+			t.Errorf("Expected ignore to take precedence over force")
+		}
+	})
+
+	t.Run("it should sample by the key of the run", func(t *testing.T) {
+		def := testDefinition(experiment.WithName("sticky"), experiment.WithPercentage(50))
+
+		var sampled, skipped int
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("user-%d", i)
+
+			first := def.Run(context.Background(), i, experiment.WithRunSampleKey(key)).Sampled
+			for j := 0; j < 5; j++ {
+				if def.Run(context.Background(), i, experiment.WithRunSampleKey(key)).Sampled != first {
+					t.Fatalf("Expected the decision for '%s' to be sticky", key)
+				}
+			}
+
+			if first {
+				sampled++
+			} else {
+				skipped++
+			}
+		}
+
+		if sampled == 0 || skipped == 0 {
+			t.Errorf("Expected keys to be sampled and skipped, got %d and %d", sampled, skipped)
+		}
+	})
+}
+
+func testDefinitionResult(t *testing.T, in int, res *experiment.Result[string]) {
+	expected := fmt.Sprint(in)
+	if res.Value != expected {
+		t.Errorf("Expected value '%s', got '%s'", expected, res.Value)
+	}
+
+	if !res.Sampled {
+		t.Errorf("Expected the run to be sampled")
+	}
+
+	observations := res.Observations()
+	if len(observations) != 3 {
+		t.Fatalf("Expected 3 observations, got %d", len(observations))
+	}
+
+	for _, o := range observations {
+		if o.Name == "correct" && (!o.Success || o.Value != expected) {
+			t.Errorf("Expected a success for '%s', got %+v", expected, o)
+		}
+
+		if o.Name == "mismatch" && o.Success {
+			t.Errorf("Expected a mismatch for '%s', got %+v", expected, o)
+		}
+	}
+}
+
+func testDefinition(cfg ...experiment.ConfigFunc) *experiment.Definition[int, string] {
+	def := experiment.NewDefinition[int, string](cfg...)
+
+	def.Control(func(_ context.Context, in int) (string, error) {
+		return fmt.Sprint(in), nil
+	})
+
+	def.Candidate("correct", func(_ context.Context, in int) (string, error) {
+		return fmt.Sprint(in), nil
+	})
+
+	def.Candidate("mismatch", func(_ context.Context, in int) (string, error) {
+		return fmt.Sprint(in + 1), nil
+	})
+
+	def.Compare(func(control, candidate string) bool {
+		return control == candidate
+	})
+
+	return def
+}
+
+func TestDefinition_ServeCandidate(t *testing.T) {
+	ctx := context.Background()
+	serve := func(fnc experiment.DefinitionFunc[int, string], percentage float64, cfg ...experiment.ConfigFunc) *experiment.Result[string] {
+		cfg = append(cfg, experiment.WithServeCandidate("rewrite", experiment.PercentageSampler(percentage)))
+		def := experiment.NewDefinition[int, string](cfg...)
+		def.Control(func(_ context.Context, in int) (string, error) {
+			return "control", nil
+		})
+		def.Candidate("rewrite", fnc)
+		def.Compare(func(control, candidate string) bool {
+			return control == candidate
+		})
+
+		res := def.Run(ctx, 1)
+		if err := res.Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		return res
+	}
+
+	for name, cfg := range map[string][]experiment.ConfigFunc{
+		"sequential": nil,
+		"concurrent": {experiment.WithConcurrency()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("it should serve from the candidate", func(t *testing.T) {
+				res := serve(func(context.Context, int) (string, error) {
+					return "rewrite", nil
+				}, 100, cfg...)
+
+				if res.Value != "rewrite" || res.ServedBy != "rewrite" {
+					t.Errorf("Expected to be served by the candidate, got '%s' from '%s'", res.Value, res.ServedBy)
+				}
+
+				candidate, _ := res.Candidate("rewrite")
+				control, _ := res.Candidate("control")
+				if !candidate.Served || control.Served {
+					t.Errorf("Expected only the candidate to be marked as served")
+				}
+
+				if candidate.Success {
+					t.Errorf("Expected the candidate to be compared against the shadow control")
+				}
+			})
+
+			t.Run("it should fall back to the control on errors", func(t *testing.T) {
+				res := serve(func(context.Context, int) (string, error) {
+					return "", errors.New("rewrite")
+				}, 100, cfg...)
+
+				if res.Value != "control" || res.Error != nil || res.ServedBy != "control" {
+					t.Errorf("Expected to be served by the control, got '%s' from '%s'", res.Value, res.ServedBy)
+				}
+
+				if control, _ := res.Candidate("control"); !control.Served {
+					t.Errorf("Expected the control to be marked as served")
+				}
+			})
+
+			t.Run("it should fall back to the control on panics", func(t *testing.T) {
+				res := serve(func(context.Context, int) (string, error) {
+					panic("rewrite")
+				}, 100, cfg...)
+
+				if res.Value != "control" || res.ServedBy != "control" {
+					t.Errorf("Expected to be served by the control, got '%s' from '%s'", res.Value, res.ServedBy)
+				}
+			})
+
+			t.Run("it should serve from the control when not selected", func(t *testing.T) {
+				res := serve(func(context.Context, int) (string, error) {
+					return "rewrite", nil
+				}, 0, cfg...)
+
+				if res.Value != "control" || res.ServedBy != "control" {
+					t.Errorf("Expected to be served by the control, got '%s' from '%s'", res.Value, res.ServedBy)
+				}
+			})
+		})
+	}
+
+	t.Run("it should sample the other candidates", func(t *testing.T) {
+		def := experiment.NewDefinition[int, string](
+			experiment.WithPercentage(100),
+			experiment.WithMaxRunsPerSecond(1, 1),
+			experiment.WithServeCandidate("rewrite", experiment.PercentageSampler(100)),
+		)
+		def.Control(func(context.Context, int) (string, error) {
+			return "control", nil
+		})
+		def.Candidate("rewrite", func(context.Context, int) (string, error) {
+			return "rewrite", nil
+		})
+
+		var expensive int
+		def.Candidate("expensive", func(context.Context, int) (string, error) {
+			expensive++
+			return "control", nil
+		})
+
+		for i := 0; i < 100; i++ {
+			res := def.Run(ctx, i)
+			if res.ServedBy != "rewrite" {
+				t.Fatalf("Expected every run to be served by the candidate, got '%s'", res.ServedBy)
+			}
+
+			if _, ok := res.Candidate("control"); !ok {
+				t.Fatalf("Expected the control to run as a shadow")
+			}
+		}
+
+		if expensive > 2 {
+			t.Errorf("Expected the rate limit to apply to the other candidates, ran %d times", expensive)
+		}
+	})
+}
+
+func TestDefinition_ControlFallback(t *testing.T) {
+	ctx := context.Background()
+	fallback := func(controlErr, candidateErr error, policy experiment.FallbackPolicy, cfg ...experiment.ConfigFunc) *experiment.Result[string] {
+		cfg = append(cfg, experiment.WithPercentage(100), experiment.WithControlFallback("rewrite", policy))
+		def := experiment.NewDefinition[int, string](cfg...)
+		def.Control(func(_ context.Context, in int) (string, error) {
+			return "control", controlErr
+		})
+		def.Candidate("rewrite", func(_ context.Context, in int) (string, error) {
+			return "rewrite", candidateErr
+		})
+
+		res := def.Run(ctx, 1)
+		if err := res.Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		return res
+	}
+
+	for name, cfg := range map[string][]experiment.ConfigFunc{
+		"sequential": nil,
+		"concurrent": {experiment.WithConcurrency()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("it should fall back to the candidate on errors", func(t *testing.T) {
+				res := fallback(errors.New("control"), nil, experiment.FallbackOnError, cfg...)
+
+				if res.Value != "rewrite" || res.Error != nil || res.ServedBy != "rewrite" {
+					t.Errorf("Expected to be served by the candidate, got '%s' from '%s'", res.Value, res.ServedBy)
+				}
+
+				control, _ := res.Candidate("control")
+				if control.Fallback != "rewrite" || control.Served {
+					t.Errorf("Expected the control to be flagged with the fallback")
+				}
+
+				if candidate, _ := res.Candidate("rewrite"); !candidate.Served {
+					t.Errorf("Expected the candidate to be marked as served")
+				}
+			})
+
+			t.Run("it should not fall back to a failing candidate", func(t *testing.T) {
+				res := fallback(errors.New("control"), errors.New("rewrite"), experiment.FallbackOnError, cfg...)
+
+				if res.Error == nil || res.Error.Error() != "control" || res.ServedBy != "control" {
+					t.Errorf("Expected the error of the control, got '%v' from '%s'", res.Error, res.ServedBy)
+				}
+
+				if control, _ := res.Candidate("control"); control.Fallback != "" {
+					t.Errorf("Expected the control not to be flagged with a fallback")
+				}
+			})
+
+			t.Run("it should only fall back on timeouts when configured", func(t *testing.T) {
+				res := fallback(context.DeadlineExceeded, nil, experiment.FallbackOnError, cfg...)
+				if res.ServedBy != "control" {
+					t.Errorf("Expected to be served by the control, got '%s'", res.ServedBy)
+				}
+
+				res = fallback(context.DeadlineExceeded, nil, experiment.FallbackOnErrorOrTimeout, cfg...)
+				if res.ServedBy != "rewrite" {
+					t.Errorf("Expected to be served by the candidate, got '%s'", res.ServedBy)
+				}
+			})
+
+			t.Run("it should not fall back when the control succeeds", func(t *testing.T) {
+				res := fallback(nil, nil, experiment.FallbackOnError, cfg...)
+				if res.Value != "control" || res.ServedBy != "control" {
+					t.Errorf("Expected to be served by the control, got '%s' from '%s'", res.Value, res.ServedBy)
+				}
+			})
+		})
+	}
+}
+
+func TestDefinition_DetachedCandidates(t *testing.T) {
+	run := func(cfg ...experiment.ConfigFunc) *experiment.Result[string] {
+		cfg = append(cfg, experiment.WithPercentage(100), experiment.WithConcurrency(), experiment.WithDetachedCandidates())
+		def := experiment.NewDefinition[int, string](cfg...)
+		def.Control(func(context.Context, int) (string, error) {
+			return "control", nil
+		})
+		def.Candidate("rewrite", func(ctx context.Context, _ int) (string, error) {
+			if _, ok := experiment.FromContext(ctx); !ok {
+				return "", errors.New("missing run info")
+			}
+
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(20 * time.Millisecond):
+				return "rewrite", nil
+			}
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		res := def.Run(ctx, 1)
+		cancel()
+
+		if err := res.Wait(context.Background()); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		return res
+	}
+
+	t.Run("it should not cancel the candidates with the caller", func(t *testing.T) {
+		obs, _ := run().Candidate("rewrite")
+		if obs.Error != nil || obs.Value != "rewrite" {
+			t.Errorf("Expected the candidate to finish, got '%s' with %v", obs.Value, obs.Error)
+		}
+	})
+
+	t.Run("it should bound the candidates by their timeout", func(t *testing.T) {
+		obs, _ := run(experiment.WithTimeout(time.Millisecond)).Candidate("rewrite")
+		if !errors.Is(obs.Error, context.DeadlineExceeded) {
+			t.Errorf("Expected the candidate to time out, got %v", obs.Error)
+		}
+	})
+}
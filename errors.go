@@ -1,11 +1,29 @@
 package experiment
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
 
-// ErrCandidatePanic represents the error that a candidate panicked.
+// ErrExecutorFull is the error recorded on the observation of a candidate that
+// was skipped because the executor was at capacity.
+var ErrExecutorFull = errors.New("experiment: executor is at capacity")
+
+// ErrExecutorShutdown is the error recorded on the observation of a candidate
+// that was skipped because the executor is shutting down.
+var ErrExecutorShutdown = errors.New("experiment: executor is shut down")
+
+// ErrCircuitOpen is the error recorded on the observation of a candidate that
+// was skipped because its circuit breaker is open.
+var ErrCircuitOpen = errors.New("experiment: circuit breaker is open")
+
+// ErrCandidatePanic represents the error that a candidate panicked. It holds
+// the recovered value and the stack of the goroutine at the time of the panic.
 type CandidatePanicError struct {
 	Name  string
 	Panic interface{}
+	Stack []byte
 }
 
 // Error returns a simple error message. It does not include the panic information.
@@ -13,6 +31,72 @@ func (e CandidatePanicError) Error() string {
 	return fmt.Sprintf("experiment candidate '%s' panicked", e.Name)
 }
 
+// IsRuntimeError reports whether the panic was caused by the Go runtime, like
+// a nil pointer dereference or an index out of range, rather than by a call
+// to panic.
+func (e CandidatePanicError) IsRuntimeError() bool {
+	return isRuntimeError(e.Panic)
+}
+
+// ControlPanicError represents the error that the control panicked. It holds
+// the recovered value and the stack of the goroutine at the time of the panic.
+type ControlPanicError struct {
+	Panic interface{}
+	Stack []byte
+}
+
+// Error returns a simple error message including the panic value. It does not
+// include the stack.
+func (e ControlPanicError) Error() string {
+	return fmt.Sprintf("experiment control panicked: %v", e.Panic)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e ControlPanicError) Unwrap() error {
+	err, _ := e.Panic.(error)
+	return err
+}
+
+// IsRuntimeError reports whether the panic was caused by the Go runtime, like
+// a nil pointer dereference or an index out of range, rather than by a call
+// to panic.
+func (e ControlPanicError) IsRuntimeError() bool {
+	return isRuntimeError(e.Panic)
+}
+
+// BackgroundPanicError represents the error that comparing or publishing the
+// observations of a concurrent run panicked, for example in a Compare, Clean or
+// Publisher. It is returned from Wait and holds the recovered value and the
+// stack of the goroutine at the time of the panic.
+type BackgroundPanicError struct {
+	Panic interface{}
+	Stack []byte
+}
+
+// Error returns a simple error message including the panic value. It does not
+// include the stack.
+func (e BackgroundPanicError) Error() string {
+	return fmt.Sprintf("experiment panicked in the background: %v", e.Panic)
+}
+
+// Unwrap returns the panic value if it is an error.
+func (e BackgroundPanicError) Unwrap() error {
+	err, _ := e.Panic.(error)
+	return err
+}
+
+// IsRuntimeError reports whether the panic was caused by the Go runtime, like
+// a nil pointer dereference or an index out of range, rather than by a call
+// to panic.
+func (e BackgroundPanicError) IsRuntimeError() bool {
+	return isRuntimeError(e.Panic)
+}
+
+func isRuntimeError(p interface{}) bool {
+	_, ok := p.(runtime.Error)
+	return ok
+}
+
 // PublishError is an error used when the publisher returns an error. It
 // combines all errors into a single error.
 type PublishError struct {
@@ -0,0 +1,257 @@
+package experiment
+
+import (
+	"context"
+	"sync"
+)
+
+// FullPolicy decides what happens to the candidates of a run when an Executor
+// is at capacity.
+type FullPolicy int
+
+const (
+	// DropCandidate skips every candidate that does not fit in the executor.
+	// The other candidates of the run still run.
+	DropCandidate FullPolicy = iota
+
+	// ControlOnly skips all candidates of a run when the executor can't take
+	// all of them, so that only the control runs.
+	ControlOnly
+
+	// Block waits until the executor has room for the candidate. The candidate
+	// waits in the background, the control and the other candidates of the
+	// run don't wait for it. At most as many candidates as the executor holds
+	// wait at the same time, the ones after that are skipped.
+	Block
+)
+
+// Executor runs candidates on a bounded set of workers. It can be shared
+// between experiments to limit the number of candidates running throughout
+// the process. The control never runs on the executor.
+type Executor struct {
+	policy   FullPolicy
+	capacity int
+	tasks    chan func()
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending int
+	waiting int
+	closed  bool
+	runs    sync.WaitGroup
+}
+
+// NewExecutor returns a new Executor which runs at most workers candidates at
+// the same time and keeps at most queue candidates waiting for a worker. When
+// both are full, the policy decides what happens to new candidates.
+// NewExecutor panics if workers is less than 1.
+func NewExecutor(workers, queue int, policy FullPolicy) *Executor {
+	if workers < 1 {
+		panic("experiment: an executor needs at least one worker")
+	}
+
+	if queue < 0 {
+		queue = 0
+	}
+
+	x := &Executor{
+		policy:   policy,
+		capacity: workers + queue,
+		tasks:    make(chan func(), queue),
+	}
+	x.cond = sync.NewCond(&x.mu)
+
+	for i := 0; i < workers; i++ {
+		go x.work()
+	}
+
+	return x
+}
+
+func (x *Executor) work() {
+	for task := range x.tasks {
+		task()
+	}
+}
+
+// InFlight returns the number of candidates which are running or waiting for
+// a worker.
+func (x *Executor) InFlight() int {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.pending
+}
+
+// Shutdown stops the executor from accepting new candidates and waits for the
+// runs using it to finish their candidates and publish their observations.
+// Runs started after Shutdown only run the control, candidates of runs that
+// are still going are skipped with ErrExecutorShutdown.
+// When the context is done first, Shutdown returns the number of candidates
+// that are still running or waiting for a worker, together with the context
+// error. The workers stop once the last candidate has finished.
+// Only experiments configured with WithExecutor use the executor. Candidates of
+// experiments without one run on their own goroutines, which Shutdown neither
+// waits for nor counts.
+func (x *Executor) Shutdown(ctx context.Context) (int, error) {
+	x.mu.Lock()
+	if !x.closed {
+		x.closed = true
+		x.cond.Broadcast()
+
+		go func() {
+			x.runs.Wait()
+			close(x.tasks)
+		}()
+	}
+	x.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		x.runs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return 0, nil
+	case <-ctx.Done():
+		return x.InFlight(), ctx.Err()
+	}
+}
+
+// begin registers a run which uses the executor. It returns false when the
+// executor is shut down.
+func (x *Executor) begin() bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	if x.closed {
+		return false
+	}
+
+	x.runs.Add(1)
+	return true
+}
+
+// end marks a run registered with begin as finished.
+func (x *Executor) end() {
+	x.runs.Done()
+}
+
+// acquire claims room for n candidates. It returns ErrExecutorFull when there
+// is not enough room.
+func (x *Executor) acquire(n int) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	switch {
+	case x.closed:
+		return ErrExecutorShutdown
+	case x.pending+n > x.capacity:
+		return ErrExecutorFull
+	}
+
+	x.pending += n
+	return nil
+}
+
+// reserve claims room for a single candidate without blocking. When there is
+// none, the candidate waits for it as long as fewer candidates than the
+// executor holds are waiting already. It returns true when the candidate has
+// to wait with await.
+func (x *Executor) reserve() (bool, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	switch {
+	case x.closed:
+		return false, ErrExecutorShutdown
+	case x.waiting == 0 && x.pending < x.capacity:
+		x.pending++
+		return false, nil
+	case x.waiting < x.capacity:
+		x.waiting++
+		return true, nil
+	}
+
+	return false, ErrExecutorFull
+}
+
+// await blocks until there is room for a candidate which has to wait according
+// to reserve.
+func (x *Executor) await() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	for !x.closed && x.pending >= x.capacity {
+		x.cond.Wait()
+	}
+	x.waiting--
+
+	if x.closed {
+		return ErrExecutorShutdown
+	}
+
+	x.pending++
+	return nil
+}
+
+func (x *Executor) release() {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.pending--
+	x.cond.Broadcast()
+}
+
+// execute hands the task to a worker. Room for it must have been acquired.
+func (x *Executor) execute(task func()) {
+	x.tasks <- func() {
+		defer x.release()
+		task()
+	}
+}
+
+// batch returns the admission of n candidates of a single run.
+func (x *Executor) batch(n int) *batch {
+	b := &batch{x: x}
+	if x.policy == ControlOnly {
+		if b.err = x.acquire(n); b.err == nil {
+			b.claimed = n
+		}
+	}
+
+	return b
+}
+
+// batch represents the room claimed on an Executor for the candidates of a
+// single run.
+type batch struct {
+	x       *Executor
+	claimed int
+	err     error
+}
+
+// take claims room for a single candidate of the run. It returns true when the
+// candidate has to wait for room with await, or the reason when the candidate
+// has to be skipped.
+func (b *batch) take() (bool, error) {
+	switch b.x.policy {
+	case Block:
+		return b.x.reserve()
+	case ControlOnly:
+	default:
+		return false, b.x.acquire(1)
+	}
+
+	if b.claimed == 0 {
+		if b.err != nil {
+			return false, b.err
+		}
+		return false, ErrExecutorFull
+	}
+
+	b.claimed--
+	return false, nil
+}
@@ -0,0 +1,347 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestExecutor(t *testing.T) {
+	t.Run("it should drop candidates when full", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.DropCandidate)
+		release := occupy(t, x)
+		defer close(release)
+
+		obs := runOnExecutor(t, x, "candidate")
+		if !obs["candidate"].Skipped {
+			t.Errorf("Expected candidate to be skipped")
+		}
+
+		if !errors.Is(obs["candidate"].Error, experiment.ErrExecutorFull) {
+			t.Errorf("Expected ErrExecutorFull, got %v", obs["candidate"].Error)
+		}
+
+		if obs["control"].Skipped {
+			t.Errorf("Expected control to never be skipped")
+		}
+	})
+
+	t.Run("it should only run the control when not all candidates fit", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.ControlOnly)
+
+		obs := runOnExecutor(t, x, "first", "second")
+		for _, name := range []string{"first", "second"} {
+			if !obs[name].Skipped {
+				t.Errorf("Expected candidate '%s' to be skipped", name)
+			}
+		}
+	})
+
+	t.Run("it should block until there is room", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.Block)
+
+		obs := runOnExecutor(t, x, "first", "second")
+		for _, name := range []string{"first", "second"} {
+			if obs[name].Skipped || obs[name].Error != nil {
+				t.Errorf("Expected candidate '%s' to run, got error %v", name, obs[name].Error)
+			}
+		}
+	})
+
+	t.Run("it should not block the control", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.Block)
+		release := occupy(t, x)
+
+		exp := experiment.New[string](experiment.WithExecutor(x), experiment.WithConcurrency())
+		exp.Force(true)
+		exp.Control(func(context.Context) (string, error) {
+			return "control", nil
+		})
+		exp.Candidate("blocked", func(context.Context) (string, error) {
+			return "control", nil
+		})
+
+		ran := make(chan struct{})
+		go func() {
+			defer close(ran)
+			exp.Run(context.Background())
+		}()
+
+		select {
+		case <-ran:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected Run to return while the candidate waits for room")
+		}
+
+		close(release)
+		if err := exp.Wait(context.Background()); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+	})
+
+	t.Run("it should bound the candidates waiting for room", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.Block)
+		release := occupy(t, x)
+
+		def := experiment.NewDefinition[int, string](
+			experiment.WithPercentage(100),
+			experiment.WithExecutor(x),
+			experiment.WithConcurrency(),
+		)
+		def.Control(func(context.Context, int) (string, error) {
+			return "control", nil
+		})
+		def.Candidate("waiting", func(context.Context, int) (string, error) {
+			return "control", nil
+		})
+
+		ctx := context.Background()
+		before := runtime.NumGoroutine()
+
+		first := def.Run(ctx, 0)
+		for i := 1; i < 1000; i++ {
+			res := def.Run(ctx, i)
+			if err := res.Wait(ctx); err != nil {
+				t.Fatalf("Expected no error waiting, got %s", err)
+			}
+
+			if obs, _ := res.Candidate("waiting"); !errors.Is(obs.Error, experiment.ErrExecutorFull) {
+				t.Fatalf("Expected ErrExecutorFull past the waiting candidates, got %v", obs.Error)
+			}
+		}
+
+		if n := runtime.NumGoroutine() - before; n > 10 {
+			t.Errorf("Expected the goroutines to stay bounded, got %d more", n)
+		}
+
+		if n := def.InFlight(); n != 1 {
+			t.Errorf("Expected 1 candidate in flight, got %d", n)
+		}
+
+		close(release)
+		if err := first.Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		if obs, _ := first.Candidate("waiting"); obs.Skipped || obs.Error != nil {
+			t.Errorf("Expected the waiting candidate to run, got %+v", obs)
+		}
+	})
+
+	t.Run("it should panic without workers", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected NewExecutor to panic")
+			}
+		}()
+
+		experiment.NewExecutor(0, 10, experiment.Block)
+	})
+}
+
+func TestExecutor_Shutdown(t *testing.T) {
+	t.Run("it should wait for candidates in flight", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.DropCandidate)
+		release := occupy(t, x)
+
+		if n := x.InFlight(); n != 1 {
+			t.Errorf("Expected 1 candidate in flight, got %d", n)
+		}
+
+		time.AfterFunc(10*time.Millisecond, func() { close(release) })
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if n, err := x.Shutdown(ctx); n != 0 || err != nil {
+			t.Errorf("Expected nothing to be abandoned, got %d with %v", n, err)
+		}
+	})
+
+	t.Run("it should report abandoned candidates", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.DropCandidate)
+		release := occupy(t, x)
+		defer close(release)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		n, err := x.Shutdown(ctx)
+		if n != 1 || !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected 1 abandoned candidate, got %d with %v", n, err)
+		}
+	})
+
+	t.Run("it should only run the control once shut down", func(t *testing.T) {
+		x := experiment.NewExecutor(1, 0, experiment.DropCandidate)
+		if _, err := x.Shutdown(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got %s", err)
+		}
+
+		obs := runOnExecutor(t, x, "candidate")
+		if _, ok := obs["candidate"]; ok {
+			t.Errorf("Expected the candidate not to run")
+		}
+	})
+}
+
+func TestExperiment_InFlight(t *testing.T) {
+	release := make(chan struct{})
+	exp := experiment.New[string](experiment.WithConcurrency())
+	exp.Force(true)
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+	exp.Candidate("slow", func(context.Context) (string, error) {
+		<-release
+		return "slow", nil
+	})
+
+	ctx := context.Background()
+	exp.Run(ctx)
+	if n := exp.InFlight(); n != 1 {
+		t.Errorf("Expected 1 candidate in flight, got %d", n)
+	}
+
+	close(release)
+	if err := exp.Wait(ctx); err != nil {
+		t.Fatalf("Expected no error waiting, got %s", err)
+	}
+
+	if n := exp.InFlight(); n != 0 {
+		t.Errorf("Expected no candidates in flight, got %d", n)
+	}
+}
+
+func TestExperiment_InFlightBlocked(t *testing.T) {
+	x := experiment.NewExecutor(1, 0, experiment.Block)
+	release := occupy(t, x)
+
+	exp := experiment.New[string](experiment.WithExecutor(x), experiment.WithConcurrency())
+	exp.Force(true)
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+	exp.Candidate("blocked", func(context.Context) (string, error) {
+		return "blocked", nil
+	})
+
+	ran := make(chan struct{})
+	go func() {
+		defer close(ran)
+		exp.Run(context.Background())
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for exp.InFlight() != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the blocked candidate to be in flight, got %d", exp.InFlight())
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	<-ran
+	if err := exp.Wait(context.Background()); err != nil {
+		t.Fatalf("Expected no error waiting, got %s", err)
+	}
+
+	if n := exp.InFlight(); n != 0 {
+		t.Errorf("Expected no candidates in flight, got %d", n)
+	}
+}
+
+func TestExecutor_ShutdownAfterPanic(t *testing.T) {
+	x := experiment.NewExecutor(1, 0, experiment.DropCandidate)
+	def := experiment.NewDefinition[int, string](
+		experiment.WithPercentage(100),
+		experiment.WithExecutor(x),
+	)
+	def.Control(func(context.Context, int) (string, error) {
+		return "control", nil
+	})
+	def.Candidate("candidate", func(context.Context, int) (string, error) {
+		return "candidate", nil
+	})
+	def.Compare(func(string, string) bool {
+		panic("compare")
+	})
+
+	func() {
+		defer func() {
+			if r := recover(); r != "compare" {
+				t.Errorf("Expected the panic of Compare, got '%v'", r)
+			}
+		}()
+
+		def.Run(context.Background(), 1)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if n, err := x.Shutdown(ctx); n != 0 || err != nil {
+		t.Errorf("Expected the run to be finished, got %d abandoned and %v", n, err)
+	}
+}
+
+// occupy keeps all workers of a single worker executor busy until the returned
+// channel is closed.
+func occupy(t *testing.T, x *experiment.Executor) chan struct{} {
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	exp := experiment.New[string](experiment.WithExecutor(x), experiment.WithConcurrency())
+	exp.Force(true)
+	exp.Control(func(context.Context) (string, error) {
+		<-started
+		return "", nil
+	})
+	exp.Candidate("busy", func(context.Context) (string, error) {
+		close(started)
+		<-release
+		return "", nil
+	})
+
+	if _, err := exp.Run(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %s", err)
+	}
+
+	return release
+}
+
+func runOnExecutor(t *testing.T, x *experiment.Executor, candidates ...string) map[string]experiment.Observation[string] {
+	obs := map[string]experiment.Observation[string]{}
+	pub := &testPublisher[string]{}
+	pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
+		obs[o.Name] = o
+		return nil
+	}
+
+	exp := experiment.New[string](experiment.WithExecutor(x)).WithPublisher(pub)
+	exp.Force(true)
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+
+	for _, name := range candidates {
+		exp.Candidate(name, func(context.Context) (string, error) {
+			return "control", nil
+		})
+	}
+
+	ctx := context.Background()
+	if _, err := exp.Run(ctx); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	if err := exp.Publish(ctx); err != nil {
+		t.Errorf("Expected no error publishing, got %s", err)
+	}
+
+	return obs
+}
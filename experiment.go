@@ -1,10 +1,6 @@
 package experiment
 
-import (
-	"context"
-	"math/rand"
-	"time"
-)
+import "context"
 
 type (
 	// BeforeFunc represents the function that gets run before the experiment
@@ -24,51 +20,99 @@ type (
 	// how to compare them. The functionality is implemented by the user. This
 	// function will only be called for candidates that did not error.
 	CompareFunc[C any] func(C, C) bool
+
+	// ErrorCompareFunc represents the function that takes the errors of the
+	// control and a candidate and knows how to compare them. This function will
+	// only be called when both returned an error.
+	ErrorCompareFunc func(control, candidate error) bool
+
+	// IgnoreFunc represents the function that decides whether a known
+	// mismatch between the control and a candidate is accepted. It receives the
+	// values that were compared and the error of the candidate.
+	IgnoreFunc[C any] func(control, candidate C, err error) bool
+
+	// MapFunc represents the function that maps the output data into the type
+	// that is compared and published. This function will only be called for
+	// candidates that did not error.
+	MapFunc[C, D any] func(C) D
 )
 
 // Experiment represents a new refactoring experiment. This is where you'll
 // define your control and candidates on and this will run the experiment
 // according to the configuration.
+// An Experiment holds the state of its last run and is meant to be created for
+// every run. Use a Definition to define an experiment once and run it many
+// times.
+// Experiment is a MappedExperiment of which the observations hold values of the
+// same type as the candidates return.
 type Experiment[C any] struct {
-	config    *Config
-	publisher Publisher[C]
-
-	shouldRun    bool
-	candidates   map[string]CandidateFunc[C]
-	observations map[string]*Observation[C]
-
-	before  BeforeFunc
-	compare CompareFunc[C]
-	clean   CleanFunc[C]
+	*MappedExperiment[C, C]
 }
 
 // New creates a new Experiment with the given configuration options.
 func New[C any](cfgs ...ConfigFunc) *Experiment[C] {
-	cfg := &Config{}
-	for _, c := range cfgs {
-		c(cfg)
-	}
-
 	return &Experiment[C]{
-		config:       cfg,
-		shouldRun:    cfg.Percentage > 0 && rand.Intn(100) <= cfg.Percentage,
-		candidates:   map[string]CandidateFunc[C]{},
-		observations: map[string]*Observation[C]{},
+		MappedExperiment: &MappedExperiment[C, C]{
+			definition: NewDefinition[struct{}, C](cfgs...).MappedDefinition,
+		},
 	}
 }
 
 // WithPublisher configures the publisher for the experiment. The publisher must
 // have the same type associated as the experiment.
 func (e *Experiment[C]) WithPublisher(pub Publisher[C]) *Experiment[C] {
-	e.publisher = pub
+	e.MappedExperiment.WithPublisher(pub)
+	return e
+}
+
+// Clean will cleanup the state of a candidate (control included). This is done
+// so the state could be cleaned up before storing for later comparison.
+func (e *Experiment[C]) Clean(fnc CleanFunc[C]) {
+	e.definition.clean = MapFunc[C, C](fnc)
+}
+
+// RunWithResult runs the experiment like Run, but returns a Result which holds
+// the outcome of the control as well as the observations of the candidates.
+// If the concurrency configuration is given, call Wait on the Result before
+// inspecting the observations.
+func (e *Experiment[C]) RunWithResult(ctx context.Context) *Result[C] {
+	return &Result[C]{MappedResult: *e.MappedExperiment.RunWithResult(ctx)}
+}
+
+// MappedExperiment represents an Experiment of which the candidates return
+// values of type C, while their observations hold values of type D. Every value
+// is mapped from C to D once the candidates have finished, which allows to
+// compare and publish a smaller or comparable part of large values only.
+type MappedExperiment[C, D any] struct {
+	definition *MappedDefinition[struct{}, C, D]
+
+	shouldRun *bool
+	result    *MappedResult[C, D]
+}
+
+// NewMapped creates a new MappedExperiment which maps the values of the control
+// and candidates with fnc, with the given configuration options. The mapped
+// value is stored in both the Value and CleanValue of the observations.
+func NewMapped[C, D any](fnc MapFunc[C, D], cfgs ...ConfigFunc) *MappedExperiment[C, D] {
+	return &MappedExperiment[C, D]{
+		definition: NewMappedDefinition[struct{}](fnc, cfgs...),
+	}
+}
+
+// WithPublisher configures the publisher for the experiment. The publisher must
+// have the mapped type associated.
+func (e *MappedExperiment[C, D]) WithPublisher(pub Publisher[D]) *MappedExperiment[C, D] {
+	e.definition.WithPublisher(pub)
 	return e
 }
 
 // Before filter to do expensive setup only when the experiment is going to run.
 // This will be skipped if the experiment doesn't need to run. A good use case
 // would be to do a deep copy of a struct.
-func (e *Experiment[C]) Before(fnc BeforeFunc) {
-	e.before = fnc
+func (e *MappedExperiment[C, D]) Before(fnc BeforeFunc) {
+	e.definition.Before(func(ctx context.Context, _ struct{}) error {
+		return fnc(ctx)
+	})
 }
 
 // Control represents the control function, this resembles the old or current
@@ -77,8 +121,8 @@ func (e *Experiment[C]) Before(fnc BeforeFunc) {
 // application will panic.
 // The output of this function will be the base to what all the candidates will
 // be compared to.
-func (e *Experiment[C]) Control(fnc CandidateFunc[C]) {
-	e.candidates["control"] = fnc
+func (e *MappedExperiment[C, D]) Control(fnc CandidateFunc[C]) {
+	e.definition.Control(withoutInput(fnc))
 }
 
 // Candidate represents a refactoring solution. The order of candidates is
@@ -86,199 +130,139 @@ func (e *Experiment[C]) Control(fnc CandidateFunc[C]) {
 // If the concurrent configuration is given, candidates will run concurrently.
 // If a candidate panics, your application will not panic, but the candidate
 // will be marked as failed.
+// The options override the configuration of the experiment for this candidate.
 // If the name is control, this will panic.
-func (e *Experiment[C]) Candidate(name string, fnc CandidateFunc[C]) error {
-	if name == "control" {
-		panic("can't use a candidate with the name 'control'")
-	}
-
-	e.candidates[name] = fnc
-	return nil
+func (e *MappedExperiment[C, D]) Candidate(name string, fnc CandidateFunc[C], opts ...CandidateOption) error {
+	return e.definition.Candidate(name, withoutInput(fnc), opts...)
 }
 
 // Compare represents the comparison functionality between a control and a
-// candidate.
-func (e *Experiment[C]) Compare(fnc CompareFunc[C]) {
-	e.compare = fnc
+// candidate. It compares the values of the observations, or their clean
+// values when the WithCompareCleaned configuration is given.
+func (e *MappedExperiment[C, D]) Compare(fnc CompareFunc[D]) {
+	e.definition.Compare(fnc)
 }
 
-// Clean will cleanup the state of a candidate (control included). This is done
-// so the state could be cleaned up before storing for later comparison.
-func (e *Experiment[C]) Clean(fnc CleanFunc[C]) {
-	e.clean = fnc
+// CompareWith represents the comparison functionality between a control and a
+// candidate, like Compare, of which the Comparison is recorded on the
+// observation of the candidate.
+func (e *MappedExperiment[C, D]) CompareWith(c Comparator[D]) {
+	e.definition.CompareWith(c)
+}
+
+// IgnoreMismatch registers a named rule which accepts known mismatches, see
+// MappedDefinition.IgnoreMismatch.
+func (e *MappedExperiment[C, D]) IgnoreMismatch(name string, fnc IgnoreFunc[D]) {
+	e.definition.IgnoreMismatch(name, fnc)
+}
+
+// CompareErrors represents the comparison functionality between the errors of
+// a control and a candidate. Once given, a candidate that returns the same
+// error as the control is a match, see MappedDefinition.CompareErrors.
+func (e *MappedExperiment[C, D]) CompareErrors(fnc ErrorCompareFunc) {
+	e.definition.CompareErrors(fnc)
 }
 
-// Force lets you overwrite the percentage. If set to true, the candidates will
-// definitely run.
-func (e *Experiment[C]) Force(f bool) {
+// Force lets you overwrite the percentage and sampler. If set to true, the
+// candidates will definitely run.
+func (e *MappedExperiment[C, D]) Force(f bool) {
 	if f {
-		e.shouldRun = true
+		e.shouldRun = &f
 	}
 }
 
 // Ignore lets you decide if the experiment should be ignored this run or not.
 // If set to true, the candidates will not run.
-func (e *Experiment[C]) Ignore(i bool) {
+func (e *MappedExperiment[C, D]) Ignore(i bool) {
 	if i {
-		e.shouldRun = false
+		shouldRun := false
+		e.shouldRun = &shouldRun
 	}
 }
 
 // Run runs all the candidates and control in a random order. The value of the
 // control function will be returned.
+// The control runs on the calling goroutine, unless the run is served from a
+// candidate. The control then runs as a shadow on a goroutine of its own. If
+// the control panics and its result is returned, the original panic is raised
+// again from Run once the candidates have been taken care of. With the
+// WithControlPanicError configuration, a ControlPanicError which holds the
+// panic and its stack is returned instead.
 // If the concurrency configuration is given, this will return as soon as the
-// control has finished running.
-func (e *Experiment[C]) Run(ctx context.Context) (C, error) {
-	// don't run the candidates, just the control
-	if !e.shouldRun {
-		fnc := e.candidates["control"]
-
-		fncCtx, cancel := e.contextWithTimeout(ctx)
-		defer cancel()
-
-		return fnc(fncCtx)
-	}
-
-	if e.before != nil {
-		if err := e.before(ctx); err != nil {
-			var r C
-			return r, err
-		}
-	}
+// control has finished running. The remaining candidates continue in the
+// background and their observations are published automatically once the last
+// one has finished. Use Wait to block until that has happened.
+func (e *MappedExperiment[C, D]) Run(ctx context.Context) (C, error) {
+	e.result = e.definition.run(ctx, struct{}{}, e.decide(ctx), false)
+	e.definition.raise(e.result)
+
+	return e.result.Value, e.result.Error
+}
 
-	return e.run(ctx)
+// RunWithResult runs the experiment like Run, but returns a MappedResult which
+// holds the outcome of the control as well as the observations of the
+// candidates.
+// If the concurrency configuration is given, call Wait on the result before
+// inspecting the observations.
+func (e *MappedExperiment[C, D]) RunWithResult(ctx context.Context) *MappedResult[C, D] {
+	e.Run(ctx)
+	return e.result
 }
 
 // Publish will publish all observations of the experiment to the configured
 // publisher. This will publish all observations, regardless if one errors or
 // not. It returns a PublishError which contains all underlying errors.
-func (e *Experiment[C]) Publish(ctx context.Context) error {
-	publishErr := &PublishError{}
-	if e.publisher != nil {
-		for _, o := range e.observations {
-			publishErr.append(e.publisher.Publish(ctx, *o))
-		}
+// If the concurrency configuration is given, the observations are published
+// automatically once all candidates have finished. Publish then waits for this
+// to happen and returns the outcome, without publishing the observations a
+// second time.
+func (e *MappedExperiment[C, D]) Publish(ctx context.Context) error {
+	if e.definition.config.Concurrency {
+		return e.Wait(ctx)
 	}
 
-	if len(publishErr.Unwrap()) == 0 {
+	if e.result == nil || e.result.execution == nil {
 		return nil
 	}
 
-	return publishErr
-}
-
-func (e *Experiment[C]) contextWithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
-	if e.config.Timeout == nil {
-		return context.WithCancel(ctx)
-	}
-
-	return context.WithTimeout(ctx, *e.config.Timeout)
-}
-
-func (e *Experiment[C]) run(ctx context.Context) (C, error) {
-	if e.config.Concurrency {
-		e.runConcurrent(ctx)
-	} else {
-		e.runSequential(ctx)
-	}
-
-	return e.conclude()
+	return e.definition.publish(ctx, e.result.execution)
 }
 
-func (e *Experiment[C]) runConcurrent(ctx context.Context) {
-	obsChan := make(chan *Observation[C])
-	for k, v := range e.candidates {
-		go func(name string, fnc CandidateFunc[C]) {
-			candidateCtx, cancel := e.contextWithTimeout(ctx)
-			defer cancel()
-
-			runCandidate(candidateCtx, name, fnc, obsChan)
-		}(k, v)
+// Wait blocks until all candidates of the last run have finished and, if the
+// concurrency configuration is given, their observations have been published.
+// It returns the error from publishing, a BackgroundPanicError when comparing or
+// publishing panicked, or the context error when the context is done before the
+// background work has finished.
+func (e *MappedExperiment[C, D]) Wait(ctx context.Context) error {
+	if e.result == nil {
+		return nil
 	}
 
-	for range e.candidates {
-		obs := <-obsChan
-		e.observations[obs.Name] = obs
-	}
+	return e.result.Wait(ctx)
 }
 
-func (e *Experiment[C]) runSequential(ctx context.Context) {
-	obsChan := make(chan *Observation[C])
-	for k, v := range e.candidates {
-		go func(name string, fnc CandidateFunc[C]) {
-			candidateCtx, cancel := e.contextWithTimeout(ctx)
-			defer cancel()
-
-			runCandidate(candidateCtx, k, v, obsChan)
-		}(k, v)
-
-		// block on waiting until there's a message in the obsChan. By doing
-		// this within the for loop, we ensure sequential operation, as this
-		// will block until the candidate is done running.
-		obs := <-obsChan
-		e.observations[obs.Name] = obs
-	}
+// InFlight returns the number of candidates of the experiment which are running,
+// waiting for a worker of the executor or blocked until it has room.
+func (e *MappedExperiment[C, D]) InFlight() int {
+	return e.definition.InFlight()
 }
 
-func (e *Experiment[C]) conclude() (C, error) {
-	control := e.observations["control"]
-
-	for _, o := range e.observations {
-		if o.Error == nil {
-			if e.clean != nil {
-				o.CleanValue = e.clean(o.Value)
-			} else {
-				o.CleanValue = o.Value
-			}
-		}
-	}
-
-	if e.compare != nil {
-		for k, o := range e.observations {
-			if o.Error == nil {
-				if k == "control" {
-					o.Success = true
-					continue
-				}
-
-				o.Success = e.compare(control.Value, o.Value)
-				o.ControlValue = control.CleanValue
-			}
-		}
+// decide decides whether the candidates should run and whether the run is
+// served from a candidate. Force and Ignore take precedence over the configured
+// sampler, percentage and rate limiters. Ignore also prevents serving from a
+// candidate.
+func (e *MappedExperiment[C, D]) decide(ctx context.Context) decision {
+	var opts runOptions
+	if e.shouldRun != nil {
+		opts.force = *e.shouldRun
+		opts.ignore = !*e.shouldRun
 	}
 
-	return control.Value, control.Error
+	return e.definition.decide(ctx, opts)
 }
 
-func runCandidate[C any](ctx context.Context, name string, fnc CandidateFunc[C], obsChan chan *Observation[C]) {
-	start := time.Now()
-
-	defer func() {
-		if name == "control" {
-			return
-		}
-
-		if r := recover(); r != nil {
-			end := time.Now()
-
-			obsChan <- &Observation[C]{
-				Name: name,
-				Error: CandidatePanicError{
-					Name:  name,
-					Panic: r,
-				},
-				Duration: end.Sub(start),
-			}
-		}
-	}()
-
-	v, err := fnc(ctx)
-	end := time.Now()
-
-	obsChan <- &Observation[C]{
-		Name:     name,
-		Value:    v,
-		Error:    err,
-		Duration: end.Sub(start),
+func withoutInput[C any](fnc CandidateFunc[C]) DefinitionFunc[struct{}, C] {
+	return func(ctx context.Context, _ struct{}) (C, error) {
+		return fnc(ctx)
 	}
 }
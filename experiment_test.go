@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -76,6 +78,14 @@ func testRun(t *testing.T, config ...experiment.ConfigFunc) {
 						if panicError.Panic == nil {
 							t.Errorf("Expected a panic, did not record one")
 						}
+
+						if !strings.Contains(string(panicError.Stack), "testExperiment") {
+							t.Errorf("Expected the stack to start at the candidate, got %s", panicError.Stack)
+						}
+
+						if panicError.IsRuntimeError() {
+							t.Errorf("Expected a user panic, got a runtime error")
+						}
 					}
 
 					return nil
@@ -251,19 +261,6 @@ func testWithTimeout(t *testing.T, o ...experiment.ConfigFunc) {
 			return "", timeFunc(ctx, time.Minute)
 		})
 
-		ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
-		defer cancel()
-		_, err := exp.Run(ctx)
-
-		if !hasRun {
-			t.Errorf("expected candidate to have run")
-		}
-
-		if err != nil {
-			t.Errorf("expected no error from the control function, got %s", err)
-		}
-
-		// time.Sleep(time.Second)
 		var candidateErr error
 		pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
 			if o.Name == "candidate" {
@@ -272,10 +269,22 @@ func testWithTimeout(t *testing.T, o ...experiment.ConfigFunc) {
 			return nil
 		}
 
+		ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+		defer cancel()
+		_, err := exp.Run(ctx)
+
+		if err != nil {
+			t.Errorf("expected no error from the control function, got %s", err)
+		}
+
 		if err := exp.Publish(context.Background()); err != nil {
 			t.Errorf("expected publishing to succeed, got error %s", err)
 		}
 
+		if !hasRun {
+			t.Errorf("expected candidate to have run")
+		}
+
 		if !errors.Is(candidateErr, context.DeadlineExceeded) {
 			t.Errorf("expected candidate to have exceeded the deadline, got %s error", candidateErr)
 		}
@@ -296,18 +305,6 @@ func testWithTimeout(t *testing.T, o ...experiment.ConfigFunc) {
 			return "", nil
 		})
 
-		ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
-		defer cancel()
-		_, err := exp.Run(ctx)
-
-		if !hasRun {
-			t.Errorf("expected candidate to have run")
-		}
-
-		if err != nil {
-			t.Errorf("expected no error from the control function, got %s", err)
-		}
-
 		var candidateErr error
 		pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
 			if o.Name == "candidate" {
@@ -316,10 +313,22 @@ func testWithTimeout(t *testing.T, o ...experiment.ConfigFunc) {
 			return nil
 		}
 
+		ctx, cancel := context.WithTimeout(context.Background(), contextTimeout)
+		defer cancel()
+		_, err := exp.Run(ctx)
+
+		if err != nil {
+			t.Errorf("expected no error from the control function, got %s", err)
+		}
+
 		if err := exp.Publish(context.Background()); err != nil {
 			t.Errorf("expected publishing to succeed, got error %s", err)
 		}
 
+		if !hasRun {
+			t.Errorf("expected candidate to have run")
+		}
+
 		if candidateErr != nil {
 			t.Errorf("expected no candidate error, got %s", candidateErr)
 		}
@@ -353,6 +362,41 @@ func TestRun_ContextPropagation(t *testing.T) {
 	}
 }
 
+func TestRun_ControlTimeout(t *testing.T) {
+	slow := func(ctx context.Context) (string, error) {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+			return "control", nil
+		}
+	}
+
+	for _, sampled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("sampled %t", sampled), func(t *testing.T) {
+			t.Run("it should not apply the candidate timeout", func(t *testing.T) {
+				exp := experiment.New[string](experiment.WithTimeout(time.Millisecond))
+				exp.Force(sampled)
+				exp.Control(slow)
+
+				if _, err := exp.Run(context.Background()); err != nil {
+					t.Errorf("Expected no error, got %s", err)
+				}
+			})
+
+			t.Run("it should apply the control timeout", func(t *testing.T) {
+				exp := experiment.New[string](experiment.WithControlTimeout(time.Millisecond))
+				exp.Force(sampled)
+				exp.Control(slow)
+
+				if _, err := exp.Run(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("Expected deadline exceeded, got %v", err)
+				}
+			})
+		})
+	}
+}
+
 func TestRun_WithConcurrency(t *testing.T) {
 	exp := experiment.New[string]()
 	exp.Force(true)
@@ -421,6 +465,542 @@ checkLoop:
 	}
 }
 
+func TestRun_ConcurrentReturnsEarly(t *testing.T) {
+	pub := &testPublisher[string]{}
+	exp := experiment.New[string](experiment.WithConcurrency()).WithPublisher(pub)
+	exp.Force(true)
+
+	release := make(chan struct{})
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+
+	exp.Candidate("slow", func(context.Context) (string, error) {
+		<-release
+		return "control", nil
+	})
+
+	exp.Compare(func(control, candidate string) bool {
+		return control == candidate
+	})
+
+	var published []string
+	pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
+		published = append(published, o.Name)
+		if o.Name == "slow" && !o.Success {
+			t.Errorf("Expected candidate to be compared before publishing")
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	val, err := exp.Run(ctx)
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	if val != "control" {
+		t.Errorf("Expected value to be 'control', got '%s'", val)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := exp.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected Wait to time out while the candidate runs, got %v", err)
+	}
+
+	close(release)
+	if err := exp.Wait(ctx); err != nil {
+		t.Errorf("Expected no error waiting, got %s", err)
+	}
+
+	if len(published) != 2 {
+		t.Errorf("Expected 2 published observations, got %d", len(published))
+	}
+}
+
+func TestRun_ConcurrentPublishAfterCancel(t *testing.T) {
+	type key struct{}
+
+	pub := &testPublisher[string]{}
+	exp := experiment.New[string](
+		experiment.WithConcurrency(),
+		experiment.WithPublishTimeout(time.Second),
+	).WithPublisher(pub)
+	exp.Force(true)
+
+	release := make(chan struct{})
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+
+	exp.Candidate("slow", func(context.Context) (string, error) {
+		<-release
+		return "control", nil
+	})
+
+	var mu sync.Mutex
+	var errs []error
+	pub.fnc = func(ctx context.Context, o experiment.Observation[string]) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		errs = append(errs, ctx.Err())
+		if ctx.Value(key{}) != "value" {
+			t.Errorf("Expected the publish context to keep the values of the run")
+		}
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("Expected the publish context to have a deadline")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+	if _, err := exp.Run(ctx); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	cancel()
+	close(release)
+	if err := exp.Wait(context.Background()); err != nil {
+		t.Errorf("Expected no error waiting, got %s", err)
+	}
+
+	if len(errs) != 2 {
+		t.Fatalf("Expected 2 published observations, got %d", len(errs))
+	}
+
+	for _, err := range errs {
+		if err != nil {
+			t.Errorf("Expected the publish context not to be cancelled, got %s", err)
+		}
+	}
+}
+
+func TestRun_ConcurrentBackgroundPanic(t *testing.T) {
+	for name, setup := range map[string]func(*experiment.Experiment[string], *testPublisher[string]){
+		"compare": func(exp *experiment.Experiment[string], _ *testPublisher[string]) {
+			exp.Compare(func(string, string) bool {
+				panic("compare")
+			})
+		},
+		"publisher": func(_ *experiment.Experiment[string], pub *testPublisher[string]) {
+			pub.fnc = func(context.Context, experiment.Observation[string]) error {
+				panic("publisher")
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			pub := &testPublisher[string]{}
+			exp := experiment.New[string](experiment.WithConcurrency()).WithPublisher(pub)
+			exp.Force(true)
+			exp.Control(func(context.Context) (string, error) {
+				return "control", nil
+			})
+			exp.Candidate("candidate", func(context.Context) (string, error) {
+				return "candidate", nil
+			})
+			setup(exp, pub)
+
+			if _, err := exp.Run(context.Background()); err != nil {
+				t.Errorf("Expected no error, got %s", err)
+			}
+
+			var panicErr experiment.BackgroundPanicError
+			if err := exp.Wait(context.Background()); !errors.As(err, &panicErr) {
+				t.Fatalf("Expected a BackgroundPanicError, got %v", err)
+			}
+
+			if panicErr.Panic != name {
+				t.Errorf("Expected panic value '%s', got '%v'", name, panicErr.Panic)
+			}
+
+			if len(panicErr.Stack) == 0 {
+				t.Errorf("Expected the stack of the panic")
+			}
+		})
+	}
+}
+
+func TestRun_ControlPanic(t *testing.T) {
+	panicky := func(cfg ...experiment.ConfigFunc) (*experiment.Experiment[string], *bool) {
+		pub := &testPublisher[string]{}
+		exp := experiment.New[string](cfg...).WithPublisher(pub)
+		exp.Force(true)
+
+		exp.Control(func(context.Context) (string, error) {
+			panic("control")
+		})
+
+		exp.Candidate("candidate", func(context.Context) (string, error) {
+			return "candidate", nil
+		})
+
+		var published bool
+		pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
+			switch o.Name {
+			case "candidate":
+				published = true
+			case "control":
+				var panicErr experiment.ControlPanicError
+				if !errors.As(o.Error, &panicErr) {
+					t.Errorf("Expected the control to record a ControlPanicError, got %v", o.Error)
+				} else if !strings.Contains(string(panicErr.Stack), "TestRun_ControlPanic") {
+					t.Errorf("Expected the stack to contain the panicking function, got %s", panicErr.Stack)
+				}
+			}
+			return nil
+		}
+
+		return exp, &published
+	}
+
+	for name, cfg := range map[string][]experiment.ConfigFunc{
+		"sequential": nil,
+		"concurrent": {experiment.WithConcurrency()},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Run("it should panic on the calling goroutine", func(t *testing.T) {
+				exp, published := panicky(cfg...)
+
+				func() {
+					defer func() {
+						if r := recover(); r != "control" {
+							t.Errorf("Expected panic value 'control', got '%v'", r)
+						}
+					}()
+
+					exp.Run(context.Background())
+				}()
+
+				if err := exp.Publish(context.Background()); err != nil {
+					t.Errorf("Expected no error publishing, got %s", err)
+				}
+
+				if !*published {
+					t.Errorf("Expected the candidate to be published")
+				}
+			})
+
+			t.Run("it should return a ControlPanicError", func(t *testing.T) {
+				exp, _ := panicky(append(cfg, experiment.WithControlPanicError())...)
+
+				_, err := exp.Run(context.Background())
+
+				var panicErr experiment.ControlPanicError
+				if !errors.As(err, &panicErr) {
+					t.Errorf("Expected ControlPanicError, got %v", err)
+				}
+			})
+		})
+	}
+
+	t.Run("it should panic when not sampled", func(t *testing.T) {
+		exp, _ := panicky()
+		exp.Ignore(true)
+
+		defer func() {
+			if r := recover(); r != "control" {
+				t.Errorf("Expected panic value 'control', got '%v'", r)
+			}
+		}()
+
+		exp.Run(context.Background())
+	})
+
+	t.Run("it should raise sentinel panics as is", func(t *testing.T) {
+		exp := experiment.New[string]()
+		exp.Force(true)
+
+		exp.Control(func(context.Context) (string, error) {
+			panic(http.ErrAbortHandler)
+		})
+
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Errorf("Expected http.ErrAbortHandler, got '%v'", r)
+			}
+		}()
+
+		exp.Run(context.Background())
+	})
+}
+
+func TestRun_CandidateRuntimePanic(t *testing.T) {
+	pub := &testPublisher[string]{}
+	exp := experiment.New[string]().WithPublisher(pub)
+	exp.Force(true)
+
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+
+	exp.Candidate("nil", func(context.Context) (string, error) {
+		var m map[string]string
+		m["key"] = "value"
+		return "", nil
+	})
+
+	var panicErr experiment.CandidatePanicError
+	pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
+		if o.Name == "nil" && !errors.As(o.Error, &panicErr) {
+			t.Errorf("Expected CandidatePanicError, got %v", o.Error)
+		}
+		return nil
+	}
+
+	ctx := context.Background()
+	exp.Run(ctx)
+	exp.Publish(ctx)
+
+	if !panicErr.IsRuntimeError() {
+		t.Errorf("Expected a runtime error, got %v", panicErr.Panic)
+	}
+}
+
+func TestRun_CandidateOptions(t *testing.T) {
+	pub := &testPublisher[string]{}
+	exp := experiment.New[string](experiment.WithConcurrency()).WithPublisher(pub)
+	exp.Force(true)
+
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+
+	exp.Candidate("slow", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	}, experiment.WithCandidateTimeout(time.Millisecond))
+
+	exp.Candidate("never", func(context.Context) (string, error) {
+		t.Errorf("Expected candidate 'never' not to run")
+		return "", nil
+	}, experiment.WithCandidatePercentage(0))
+
+	var finished bool
+	exp.Candidate("sequential", func(context.Context) (string, error) {
+		finished = true
+		return "control", nil
+	}, experiment.WithCandidateConcurrency(false))
+
+	observations := map[string]experiment.Observation[string]{}
+	pub.fnc = func(_ context.Context, o experiment.Observation[string]) error {
+		observations[o.Name] = o
+		return nil
+	}
+
+	ctx := context.Background()
+	if _, err := exp.Run(ctx); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	if !finished {
+		t.Errorf("Expected the sequential candidate to finish before Run returns")
+	}
+
+	if err := exp.Wait(ctx); err != nil {
+		t.Errorf("Expected no error waiting, got %s", err)
+	}
+
+	if _, ok := observations["never"]; ok {
+		t.Errorf("Expected no observation for a candidate that was not sampled")
+	}
+
+	slow := observations["slow"]
+	if !errors.Is(slow.Error, context.DeadlineExceeded) {
+		t.Errorf("Expected the candidate to time out, got %v", slow.Error)
+	}
+
+	if slow.Config.Timeout == nil || *slow.Config.Timeout != time.Millisecond {
+		t.Errorf("Expected the timeout to be recorded, got %v", slow.Config.Timeout)
+	}
+
+	if !slow.Config.Concurrency {
+		t.Errorf("Expected the candidate to run concurrently")
+	}
+
+	if observations["sequential"].Config.Concurrency {
+		t.Errorf("Expected the candidate not to run concurrently")
+	}
+}
+
+func TestRun_CompareCleaned(t *testing.T) {
+	for name, tc := range map[string]struct {
+		cfg     []experiment.ConfigFunc
+		success bool
+	}{
+		"raw values":   {nil, false},
+		"clean values": {[]experiment.ConfigFunc{experiment.WithCompareCleaned()}, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			exp := experiment.New[string](tc.cfg...)
+			exp.Force(true)
+			exp.Control(func(context.Context) (string, error) {
+				return "Control", nil
+			})
+			exp.Candidate("candidate", func(context.Context) (string, error) {
+				return "control", nil
+			})
+			exp.Clean(strings.ToLower)
+			exp.Compare(func(control, candidate string) bool {
+				return control == candidate
+			})
+
+			obs, _ := exp.RunWithResult(context.Background()).Candidate("candidate")
+			if obs.Success != tc.success {
+				t.Errorf("Expected success to be %t, got %t", tc.success, obs.Success)
+			}
+		})
+	}
+}
+
+func TestRun_CompareWith(t *testing.T) {
+	exp := experiment.New[string]()
+	exp.Force(true)
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+	exp.Candidate("candidate", func(context.Context) (string, error) {
+		return "candidate", nil
+	})
+	exp.CompareWith(experiment.ComparatorFunc[string](func(control, candidate string) experiment.Comparison {
+		return experiment.Comparison{
+			Match:       control == candidate,
+			Differences: []experiment.Difference{{Control: control, Candidate: candidate}},
+		}
+	}))
+
+	obs, _ := exp.RunWithResult(context.Background()).Candidate("candidate")
+	if obs.Success || obs.Mismatch != experiment.ValueMismatch {
+		t.Errorf("Expected the candidate to mismatch")
+	}
+
+	if obs.Comparison == nil || len(obs.Comparison.Differences) != 1 {
+		t.Fatalf("Expected the comparison to be recorded, got %v", obs.Comparison)
+	}
+
+	if d := obs.Comparison.Differences[0]; d.Control != "control" || d.Candidate != "candidate" {
+		t.Errorf("Expected the difference to hold both values, got %v", d)
+	}
+}
+
+func TestRun_IgnoreMismatch(t *testing.T) {
+	errTimeout := errors.New("upstream timeout")
+
+	exp := experiment.New[string]()
+	exp.Force(true)
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+	exp.Candidate("casing", func(context.Context) (string, error) {
+		return "CONTROL", nil
+	})
+	exp.Candidate("timeout", func(context.Context) (string, error) {
+		return "", errTimeout
+	})
+	exp.Candidate("mismatch", func(context.Context) (string, error) {
+		return "other", nil
+	})
+	exp.Compare(func(control, candidate string) bool {
+		return control == candidate
+	})
+	exp.IgnoreMismatch("casing", func(control, candidate string, _ error) bool {
+		return strings.EqualFold(control, candidate)
+	})
+	exp.IgnoreMismatch("timeouts", func(_, _ string, err error) bool {
+		return errors.Is(err, errTimeout)
+	})
+
+	res := exp.RunWithResult(context.Background())
+	for name, rule := range map[string]string{"casing": "casing", "timeout": "timeouts", "mismatch": ""} {
+		if obs, _ := res.Candidate(name); obs.IgnoredBy != rule {
+			t.Errorf("Expected candidate '%s' to be ignored by '%s', got '%s'", name, rule, obs.IgnoredBy)
+		}
+	}
+
+	if ignored := res.Ignored(); len(ignored) != 2 {
+		t.Errorf("Expected 2 ignored candidates, got %d", len(ignored))
+	}
+
+	if mismatched := res.Mismatched(); len(mismatched) != 1 || mismatched[0].Name != "mismatch" {
+		t.Errorf("Expected only the real mismatch, got %v", mismatched)
+	}
+
+	if failed := res.Failed(); len(failed) != 0 {
+		t.Errorf("Expected no failed candidates, got %v", failed)
+	}
+}
+
+func TestRun_IgnoreMismatchWithoutComparison(t *testing.T) {
+	exp := experiment.New[string]()
+	exp.Force(true)
+	exp.Control(func(context.Context) (string, error) {
+		return "control", nil
+	})
+	exp.Candidate("candidate", func(context.Context) (string, error) {
+		return "other", nil
+	})
+	exp.IgnoreMismatch("everything", func(string, string, error) bool {
+		return true
+	})
+
+	res := exp.RunWithResult(context.Background())
+	if obs, _ := res.Candidate("candidate"); obs.IgnoredBy != "" {
+		t.Errorf("Expected a candidate which wasn't compared not to be ignored, got '%s'", obs.IgnoredBy)
+	}
+
+	if ignored := res.Ignored(); len(ignored) != 0 {
+		t.Errorf("Expected no ignored candidates, got %d", len(ignored))
+	}
+}
+
+func TestRun_Mapped(t *testing.T) {
+	type response struct {
+		ID   int
+		Body string
+	}
+
+	pub := &testPublisher[int]{}
+	observations := map[string]experiment.Observation[int]{}
+	pub.fnc = func(_ context.Context, o experiment.Observation[int]) error {
+		observations[o.Name] = o
+		return nil
+	}
+
+	exp := experiment.NewMapped(func(r response) int {
+		return r.ID
+	}).WithPublisher(pub)
+	exp.Force(true)
+	exp.Control(func(context.Context) (response, error) {
+		return response{ID: 1, Body: "control"}, nil
+	})
+	exp.Candidate("candidate", func(context.Context) (response, error) {
+		return response{ID: 1, Body: "candidate"}, nil
+	})
+	exp.Compare(func(control, candidate int) bool {
+		return control == candidate
+	})
+
+	ctx := context.Background()
+	res, err := exp.Run(ctx)
+	if err != nil || res.Body != "control" {
+		t.Errorf("Expected the response of the control, got %v with %v", res, err)
+	}
+
+	if err := exp.Publish(ctx); err != nil {
+		t.Fatalf("Expected no error publishing, got %s", err)
+	}
+
+	obs := observations["candidate"]
+	if !obs.Success {
+		t.Errorf("Expected the mapped values to match")
+	}
+
+	if obs.Value != 1 || obs.CleanValue != 1 || obs.ControlValue != 1 {
+		t.Errorf("Expected the observation to hold the mapped values, got %d, %d and %d", obs.Value, obs.CleanValue, obs.ControlValue)
+	}
+}
+
 func TestPublish_Errors(t *testing.T) {
 	pub := &testPublisher[string]{}
 	pub.fnc = func(ctx context.Context, o experiment.Observation[string]) error {
@@ -0,0 +1,64 @@
+package experiment
+
+import (
+	"errors"
+	"reflect"
+)
+
+// MismatchKind describes how the outcome of a candidate differs from the
+// outcome of the control.
+type MismatchKind int
+
+const (
+	// NoMismatch means the candidate matched the control, or was not compared.
+	NoMismatch MismatchKind = iota
+
+	// ValueMismatch means both returned a value, but the values differ.
+	ValueMismatch
+
+	// ErrorMismatch means both returned an error, but the errors differ.
+	ErrorMismatch
+
+	// ControlErrored means the control returned an error, while the candidate
+	// returned a value.
+	ControlErrored
+
+	// CandidateErrored means the candidate returned an error, while the
+	// control returned a value.
+	CandidateErrored
+)
+
+// String returns a readable representation of the kind.
+func (k MismatchKind) String() string {
+	switch k {
+	case NoMismatch:
+		return "none"
+	case ValueMismatch:
+		return "value"
+	case ErrorMismatch:
+		return "error"
+	case ControlErrored:
+		return "control-errored"
+	case CandidateErrored:
+		return "candidate-errored"
+	default:
+		return "unknown"
+	}
+}
+
+// ErrorsIs considers errors equal when either one is the other according to
+// errors.Is.
+func ErrorsIs(control, candidate error) bool {
+	return errors.Is(candidate, control) || errors.Is(control, candidate)
+}
+
+// SameErrorType considers errors equal when they are of the same type. Note
+// that all errors created with errors.New are of the same type.
+func SameErrorType(control, candidate error) bool {
+	return reflect.TypeOf(control) == reflect.TypeOf(candidate)
+}
+
+// SameErrorMessage considers errors equal when they have the same message.
+func SameErrorMessage(control, candidate error) bool {
+	return control.Error() == candidate.Error()
+}
@@ -0,0 +1,81 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestErrorCompareFuncs(t *testing.T) {
+	errNotFound := errors.New("not found")
+	pathErr := &fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist}
+
+	for name, tc := range map[string]struct {
+		fnc       experiment.ErrorCompareFunc
+		control   error
+		candidate error
+		equal     bool
+	}{
+		"errors.Is with a wrapped error":  {experiment.ErrorsIs, errNotFound, fmt.Errorf("wrapped: %w", errNotFound), true},
+		"errors.Is with another error":    {experiment.ErrorsIs, errNotFound, errors.New("not found"), false},
+		"same type":                       {experiment.SameErrorType, pathErr, &fs.PathError{Op: "stat"}, true},
+		"different type":                  {experiment.SameErrorType, pathErr, errNotFound, false},
+		"same message":                    {experiment.SameErrorMessage, errNotFound, errors.New("not found"), true},
+		"different message":               {experiment.SameErrorMessage, errNotFound, errors.New("gone"), false},
+		"errors.Is with the wrapped side": {experiment.ErrorsIs, fmt.Errorf("wrapped: %w", errNotFound), errNotFound, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if equal := tc.fnc(tc.control, tc.candidate); equal != tc.equal {
+				t.Errorf("Expected %t, got %t", tc.equal, equal)
+			}
+		})
+	}
+}
+
+func TestDefinition_CompareErrors(t *testing.T) {
+	errNotFound := errors.New("not found")
+	run := func(controlErr, candidateErr error) experiment.Observation[string] {
+		def := experiment.NewDefinition[int, string](experiment.WithPercentage(100))
+		def.Control(func(context.Context, int) (string, error) {
+			return "value", controlErr
+		})
+		def.Candidate("candidate", func(context.Context, int) (string, error) {
+			return "value", candidateErr
+		})
+		def.Compare(func(control, candidate string) bool {
+			return control == candidate
+		})
+		def.CompareErrors(experiment.ErrorsIs)
+
+		obs, _ := def.Run(context.Background(), 1).Candidate("candidate")
+		return obs
+	}
+
+	for name, tc := range map[string]struct {
+		control   error
+		candidate error
+		success   bool
+		mismatch  experiment.MismatchKind
+	}{
+		"no errors":         {nil, nil, true, experiment.NoMismatch},
+		"same errors":       {errNotFound, errNotFound, true, experiment.NoMismatch},
+		"different errors":  {errNotFound, errors.New("gone"), false, experiment.ErrorMismatch},
+		"control errored":   {errNotFound, nil, false, experiment.ControlErrored},
+		"candidate errored": {nil, errNotFound, false, experiment.CandidateErrored},
+	} {
+		t.Run(name, func(t *testing.T) {
+			obs := run(tc.control, tc.candidate)
+			if obs.Success != tc.success {
+				t.Errorf("Expected success to be %t, got %t", tc.success, obs.Success)
+			}
+
+			if obs.Mismatch != tc.mismatch {
+				t.Errorf("Expected a mismatch of kind '%s', got '%s'", tc.mismatch, obs.Mismatch)
+			}
+		})
+	}
+}
@@ -3,12 +3,22 @@ package experiment
 import "time"
 
 // Observation represents the outcome of a candidate that has run.
+// Comparison holds the outcome of comparing the candidate against the control,
+// it's nil when the candidate was not compared. IgnoredBy holds the name of the
+// ignore rule that accepted the mismatch of the candidate.
 type Observation[C any] struct {
 	Duration     time.Duration
 	Error        error
 	Success      bool
+	Mismatch     MismatchKind
+	IgnoredBy    string
+	Comparison   *Comparison
+	Skipped      bool
+	Served       bool
+	Fallback     string
 	Name         string
 	Value        C
 	CleanValue   C
 	ControlValue C
+	Config       CandidateConfig
 }
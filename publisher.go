@@ -2,7 +2,11 @@ package experiment
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"strings"
+	"sync"
 )
 
 // Logger represents the interface that experiment expects for a logger.
@@ -25,24 +29,185 @@ func NewLogPublisher[C any](name string, logger Logger) *LogPublisher[C] {
 
 // LogPublisher is a publisher that writes out the observation values as a log
 // line. If no Logger is provided, the standard library logger will be used.
+// StackDepth is the amount of stack frames that are logged when a candidate or
+// the control panicked. Zero disables logging the stack, a negative value logs
+// the full stack.
 type LogPublisher[C any] struct {
-	Name   string
-	Logger Logger
+	Name       string
+	Logger     Logger
+	StackDepth int
 }
 
 // Publish will publish all the Observation variables as a log line. It is in
 // the following format:
 // [Experiment Observation] name=%s duration=%s success=%t value=%v error=%v
+// When the candidate did not match the control, mismatch=%s is added with the
+// kind of mismatch. The score and differences of the Comparison are added as
+// score=%.2f and differences=[%s], in which every difference is formatted as
+// path: control=%v candidate=%v, or as path: added candidate=%v and
+// path: removed control=%v. When an ignore rule accepted the mismatch,
+// ignored=%s is added with the name of the rule. When the control fell back to
+// a candidate, fallback=%s is added with the name of the candidate. When the
+// observation holds a panic and StackDepth is set, the stack follows on the
+// next lines.
 func (l *LogPublisher[C]) Publish(_ context.Context, o Observation[C]) error {
 	msg := "[Experiment Observation: %s] name=%s duration=%s success=%t value=%v error=%v"
 	args := []interface{}{l.Name, o.Name, o.Duration, o.Success, o.CleanValue, o.Error}
+	if o.Mismatch != NoMismatch {
+		msg += " mismatch=%s"
+		args = append(args, o.Mismatch)
+	}
+
+	if c := o.Comparison; c != nil && c.Score != nil {
+		msg += " score=%.2f"
+		args = append(args, *c.Score)
+	}
+
+	if c := o.Comparison; c != nil && len(c.Differences) > 0 {
+		msg += " differences=[%s]"
+		args = append(args, differences(c.Differences))
+	}
+
+	if o.IgnoredBy != "" {
+		msg += " ignored=%s"
+		args = append(args, o.IgnoredBy)
+	}
+
+	if o.Fallback != "" {
+		msg += " fallback=%s"
+		args = append(args, o.Fallback)
+	}
+
+	if stack := l.stack(o.Error); stack != nil {
+		msg += "\n%s"
+		args = append(args, stack)
+	}
+
+	l.printf(msg, args...)
+	return nil
+}
+
+// PublishBreakerEvent will publish the state transition of a circuit breaker as
+// a log line. It is in the following format:
+// [Experiment Breaker: %s] experiment=%s candidate=%s from=%s to=%s
+func (l *LogPublisher[C]) PublishBreakerEvent(_ context.Context, e BreakerEvent) error {
+	msg := "[Experiment Breaker: %s] experiment=%s candidate=%s from=%s to=%s"
+	l.printf(msg, l.Name, e.Experiment, e.Candidate, e.From, e.To)
+	return nil
+}
+
+func (l *LogPublisher[C]) printf(msg string, args ...interface{}) {
 	if l.Logger == nil {
 		log.Printf(msg, args...)
 	} else {
 		l.Logger.Printf(msg, args...)
 	}
+}
+
+func differences(diffs []Difference) string {
+	parts := make([]string, len(diffs))
+	for i, d := range diffs {
+		switch d.Kind {
+		case DifferenceAdded:
+			parts[i] = fmt.Sprintf("%s: added candidate=%v", d.Path, d.Candidate)
+		case DifferenceRemoved:
+			parts[i] = fmt.Sprintf("%s: removed control=%v", d.Path, d.Control)
+		default:
+			parts[i] = fmt.Sprintf("%s: control=%v candidate=%v", d.Path, d.Control, d.Candidate)
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func (l *LogPublisher[C]) stack(err error) []byte {
+	if l.StackDepth == 0 {
+		return nil
+	}
+
+	var stack []byte
+	var candidatePanic CandidatePanicError
+	var controlPanic ControlPanicError
+	switch {
+	case errors.As(err, &candidatePanic):
+		stack = candidatePanic.Stack
+	case errors.As(err, &controlPanic):
+		stack = controlPanic.Stack
+	}
+
+	if stack == nil {
+		return nil
+	}
+
+	return TrimStack(stack, l.StackDepth)
+}
+
+// Counts holds the number of observations of a candidate per outcome.
+// Mismatches and failures accepted by an ignore rule are counted as Ignored
+// only, so Mismatched and Failed hold the real mismatches.
+type Counts struct {
+	Matched    int64
+	Mismatched int64
+	Failed     int64
+	Ignored    int64
+	Skipped    int64
+}
+
+// CountPublisher is a publisher that counts the outcomes of the observations
+// per candidate, for example to expose them as metrics. The control is not
+// counted. The zero value is ready to use and it is safe to use from multiple
+// goroutines.
+type CountPublisher[C any] struct {
+	mu     sync.Mutex
+	counts map[string]Counts
+}
+
+// NewCountPublisher returns a new CountPublisher.
+func NewCountPublisher[C any]() *CountPublisher[C] {
+	return &CountPublisher[C]{counts: map[string]Counts{}}
+}
+
+// Publish counts the outcome of the observation.
+func (p *CountPublisher[C]) Publish(_ context.Context, o Observation[C]) error {
+	if o.Name == "control" {
+		return nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.counts == nil {
+		p.counts = map[string]Counts{}
+	}
+
+	c := p.counts[o.Name]
+	switch {
+	case o.Skipped:
+		c.Skipped++
+	case o.IgnoredBy != "":
+		c.Ignored++
+	case o.Success:
+		c.Matched++
+	case o.Error != nil:
+		c.Failed++
+	default:
+		c.Mismatched++
+	}
+	p.counts[o.Name] = c
 
 	return nil
 }
 
-var _ Publisher[string] = &LogPublisher[string]{}
+// Counts returns the counts of the candidate with the given name.
+func (p *CountPublisher[C]) Counts(candidate string) Counts {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.counts[candidate]
+}
+
+var (
+	_ Publisher[string] = &LogPublisher[string]{}
+	_ BreakerPublisher  = &LogPublisher[string]{}
+	_ Publisher[string] = &CountPublisher[string]{}
+)
@@ -3,6 +3,8 @@ package experiment_test
 import (
 	"context"
 	"fmt"
+	"strings"
+	"testing"
 
 	"github.com/jelmersnoeck/experiment/v3"
 )
@@ -25,6 +27,116 @@ func ExampleLogPublisher() {
 	// Output: Hello world!
 }
 
+func TestLogPublisher_Stack(t *testing.T) {
+	stack := []byte("goroutine 1 [running]:\nmain.panicky()\n\t/main.go:10 +0x1\nmain.main()\n\t/main.go:5 +0x1\n")
+
+	tcs := map[string]struct {
+		depth    int
+		err      error
+		expected []string
+		excluded []string
+	}{
+		"without depth": {
+			err:      experiment.CandidatePanicError{Name: "candidate", Panic: "boom", Stack: stack},
+			excluded: []string{"goroutine 1"},
+		},
+		"with depth": {
+			depth:    1,
+			err:      experiment.CandidatePanicError{Name: "candidate", Panic: "boom", Stack: stack},
+			expected: []string{"goroutine 1", "main.panicky()"},
+			excluded: []string{"main.main()"},
+		},
+		"with full stack": {
+			depth:    -1,
+			err:      experiment.ControlPanicError{Panic: "boom", Stack: stack},
+			expected: []string{"main.panicky()", "main.main()"},
+		},
+		"without panic": {
+			depth:    -1,
+			err:      fmt.Errorf("regular error"),
+			excluded: []string{"goroutine 1"},
+		},
+	}
+
+	for name, tc := range tcs {
+		t.Run(name, func(t *testing.T) {
+			logger := &bufferLogger{}
+			pub := experiment.NewLogPublisher[string]("publisher", logger)
+			pub.StackDepth = tc.depth
+
+			pub.Publish(context.Background(), experiment.Observation[string]{Name: "candidate", Error: tc.err})
+
+			for _, e := range tc.expected {
+				if !strings.Contains(logger.String(), e) {
+					t.Errorf("Expected log to contain '%s', got '%s'", e, logger)
+				}
+			}
+
+			for _, e := range tc.excluded {
+				if strings.Contains(logger.String(), e) {
+					t.Errorf("Expected log not to contain '%s', got '%s'", e, logger)
+				}
+			}
+		})
+	}
+}
+
+func TestLogPublisher_Comparison(t *testing.T) {
+	score := 0.5
+	logger := &bufferLogger{}
+	pub := experiment.NewLogPublisher[string]("publisher", logger)
+	pub.Publish(context.Background(), experiment.Observation[string]{
+		Name:     "candidate",
+		Mismatch: experiment.ValueMismatch,
+		Comparison: &experiment.Comparison{
+			Score: &score,
+			Differences: []experiment.Difference{
+				{Path: ".Name", Control: "control", Candidate: "candidate"},
+				{Path: ".Tags[1]", Kind: experiment.DifferenceAdded, Candidate: "new"},
+			},
+		},
+	})
+
+	for _, e := range []string{"mismatch=value", "score=0.50", "differences=[.Name: control=control candidate=candidate, .Tags[1]: added candidate=new]"} {
+		if !strings.Contains(logger.String(), e) {
+			t.Errorf("Expected log to contain '%s', got '%s'", e, logger)
+		}
+	}
+}
+
+func TestCountPublisher(t *testing.T) {
+	pub := experiment.NewCountPublisher[string]()
+	ctx := context.Background()
+	for _, o := range []experiment.Observation[string]{
+		{Name: "control", Success: true},
+		{Name: "candidate", Success: true},
+		{Name: "candidate"},
+		{Name: "candidate", Error: fmt.Errorf("failed")},
+		{Name: "candidate", Error: fmt.Errorf("failed"), IgnoredBy: "known"},
+		{Name: "candidate", IgnoredBy: "known"},
+		{Name: "candidate", Error: experiment.ErrExecutorFull, Skipped: true},
+	} {
+		pub.Publish(ctx, o)
+	}
+
+	expected := experiment.Counts{Matched: 1, Mismatched: 1, Failed: 1, Ignored: 2, Skipped: 1}
+	if c := pub.Counts("candidate"); c != expected {
+		t.Errorf("Expected counts %+v, got %+v", expected, c)
+	}
+
+	if c := pub.Counts("control"); c != (experiment.Counts{}) {
+		t.Errorf("Expected the control not to be counted, got %+v", c)
+	}
+}
+
+type bufferLogger struct {
+	strings.Builder
+}
+
+func (l *bufferLogger) Printf(s string, a ...interface{}) {
+	fmt.Fprintf(l, s, a...)
+}
+
 type fmtLogger struct{}
 
 func (l *fmtLogger) Printf(s string, a ...interface{}) {
@@ -0,0 +1,94 @@
+package experiment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrInvalidRateLimit is returned when a rate limit doesn't allow any runs,
+// because the rate is not above 0 or the burst is less than 1.
+var ErrInvalidRateLimit = errors.New("experiment: rate limit must allow at least one run")
+
+// NewRateLimiter returns a new RateLimiter which allows perSecond runs every
+// second on average, with bursts of up to burst runs. It panics if perSecond
+// is not above 0 or burst is less than 1, as the limiter would never allow a
+// run.
+func NewRateLimiter(perSecond float64, burst int) *RateLimiter {
+	if !(perSecond > 0) || burst < 1 {
+		panic(fmt.Errorf("%w, got %v per second with a burst of %d", ErrInvalidRateLimit, perSecond, burst))
+	}
+
+	return &RateLimiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// RateLimiter caps how often the candidates of an experiment run through a
+// token bucket. A single RateLimiter can be shared by several experiments so
+// that they draw on one budget. It is safe for concurrent use.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// Sample takes a token from the bucket and reports whether there was one. This
+// allows a RateLimiter to be combined with other samplers.
+func (l *RateLimiter) Sample(context.Context, string) bool {
+	return l.take()
+}
+
+func (l *RateLimiter) take() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+
+	if l.tokens < 1 {
+		return false
+	}
+
+	l.tokens--
+	return true
+}
+
+// refund puts back a token which was taken but not used.
+func (l *RateLimiter) refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.tokens++; l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// allow takes a token from all configured rate limiters. If one of them has no
+// tokens left, the tokens taken from the others are put back.
+func (c *Config) allow() bool {
+	for i, l := range c.RateLimiters {
+		if !l.take() {
+			for _, taken := range c.RateLimiters[:i] {
+				taken.refund()
+			}
+
+			return false
+		}
+	}
+
+	return true
+}
+
+var _ Sampler = &RateLimiter{}
@@ -0,0 +1,84 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestRateLimiter(t *testing.T) {
+	countSampled := func(n int, cfg ...experiment.ConfigFunc) int {
+		var count int
+		for i := 0; i < n; i++ {
+			if sampled(cfg...) {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	t.Run("it should cap the runs to the burst", func(t *testing.T) {
+		limit := experiment.WithMaxRunsPerSecond(0.01, 3)
+		if count := countSampled(10, experiment.WithPercentage(100), limit); count != 3 {
+			t.Errorf("Expected 3 runs, got %d", count)
+		}
+	})
+
+	t.Run("it should share the budget between experiments", func(t *testing.T) {
+		shared := experiment.NewRateLimiter(0.01, 4)
+		first := countSampled(10, experiment.WithPercentage(100), experiment.WithRateLimiter(shared))
+		second := countSampled(10, experiment.WithPercentage(100), experiment.WithRateLimiter(shared))
+
+		if first+second != 4 {
+			t.Errorf("Expected 4 runs in total, got %d", first+second)
+		}
+	})
+
+	t.Run("it should not take tokens when not sampled", func(t *testing.T) {
+		limiter := experiment.NewRateLimiter(0.01, 1)
+		countSampled(10, experiment.WithPercentage(0), experiment.WithRateLimiter(limiter))
+
+		if !limiter.Sample(context.Background(), "") {
+			t.Errorf("Expected the token to be left in the bucket")
+		}
+	})
+
+	t.Run("it should put back tokens when another limiter is empty", func(t *testing.T) {
+		own := experiment.NewRateLimiter(0.01, 1)
+		empty := experiment.NewRateLimiter(0.01, 1)
+		empty.Sample(context.Background(), "")
+		if sampled(experiment.WithPercentage(100), experiment.WithRateLimiter(own), experiment.WithRateLimiter(empty)) {
+			t.Errorf("Expected the empty limiter to prevent the run")
+		}
+
+		if !own.Sample(context.Background(), "") {
+			t.Errorf("Expected the token to be put back")
+		}
+	})
+
+	t.Run("it should reject limits which never allow a run", func(t *testing.T) {
+		for name, fnc := range map[string]func(){
+			"no burst":        func() { experiment.NewRateLimiter(0.5, 0) },
+			"negative burst":  func() { experiment.NewRateLimiter(1, -1) },
+			"no rate":         func() { experiment.WithMaxRunsPerSecond(0, 1) },
+			"negative rate":   func() { experiment.WithMaxRunsPerSecond(-1, 1) },
+			"NaN rate":        func() { experiment.NewRateLimiter(math.NaN(), 1) },
+			"config no burst": func() { experiment.WithMaxRunsPerSecond(0.5, 0) },
+		} {
+			func() {
+				defer func() {
+					err, _ := recover().(error)
+					if !errors.Is(err, experiment.ErrInvalidRateLimit) {
+						t.Errorf("Expected %s to panic with ErrInvalidRateLimit, got %v", name, err)
+					}
+				}()
+
+				fnc()
+			}()
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package experiment
+
+import (
+	"context"
+	"sort"
+)
+
+// Result represents the outcome of a single run. The value and error of the
+// control are available straight away, the observations once all candidates
+// have finished.
+type Result[C any] struct {
+	MappedResult[C, C]
+}
+
+// MappedResult represents the outcome of a single run of a MappedDefinition.
+// The value and error are of the type the candidates return, the observations
+// hold the mapped values.
+// ServedBy is the name of the candidate, or control, the value and error were
+// taken from.
+type MappedResult[C, D any] struct {
+	Value    C
+	Error    error
+	Sampled  bool
+	ServedBy string
+
+	execution *execution[C, D]
+}
+
+// execution holds the state of a single run. It is owned by the goroutine
+// running the candidates until done is closed. The raw observations are mapped
+// into observations once all candidates have finished.
+type execution[C, D any] struct {
+	raw          map[string]*Observation[C]
+	observations map[string]*Observation[D]
+	events       []BreakerEvent
+	tickets      map[string]breakerTicket
+	done         chan struct{}
+	err          error
+}
+
+// Wait blocks until all candidates of the run have finished and their
+// observations have been published. It returns the error from publishing, a
+// BackgroundPanicError when comparing or publishing panicked, or the context
+// error when the context is done before the background work has finished.
+func (r *MappedResult[C, D]) Wait(ctx context.Context) error {
+	if r.execution == nil {
+		return nil
+	}
+
+	select {
+	case <-r.execution.done:
+		return r.execution.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Observations returns the observations of the run, control included, sorted
+// by name. It returns nil while candidates are still running, call Wait first
+// when running concurrently.
+func (r *MappedResult[C, D]) Observations() []Observation[D] {
+	if !r.finished() {
+		return nil
+	}
+
+	observations := make([]Observation[D], 0, len(r.execution.observations))
+	for _, o := range r.execution.observations {
+		observations = append(observations, *o)
+	}
+
+	sort.Slice(observations, func(i, j int) bool {
+		return observations[i].Name < observations[j].Name
+	})
+
+	return observations
+}
+
+// Candidate returns the observation of the candidate with the given name. It
+// returns false when there is no such observation, or when candidates are
+// still running.
+func (r *MappedResult[C, D]) Candidate(name string) (Observation[D], bool) {
+	if !r.finished() {
+		return Observation[D]{}, false
+	}
+
+	o, ok := r.execution.observations[name]
+	if !ok {
+		return Observation[D]{}, false
+	}
+
+	return *o, true
+}
+
+// Mismatched returns the observations of the candidates that ran without an
+// error but did not match the control. Without a compare function, none of the
+// candidates match. Mismatches accepted by an ignore rule are not included.
+func (r *MappedResult[C, D]) Mismatched() []Observation[D] {
+	return r.filter(func(o Observation[D]) bool {
+		return o.Error == nil && !o.Success && o.IgnoredBy == ""
+	})
+}
+
+// Failed returns the observations of the candidates that returned an error,
+// panicked or timed out. Skipped candidates, and candidates that returned the
+// same error as the control according to CompareErrors, are not included.
+func (r *MappedResult[C, D]) Failed() []Observation[D] {
+	return r.filter(func(o Observation[D]) bool {
+		return o.Error != nil && !o.Skipped && !o.Success && o.IgnoredBy == ""
+	})
+}
+
+// Ignored returns the observations of the candidates that did not match the
+// control, but were accepted by an ignore rule. These are not included in
+// Mismatched and Failed.
+func (r *MappedResult[C, D]) Ignored() []Observation[D] {
+	return r.filter(func(o Observation[D]) bool {
+		return o.IgnoredBy != ""
+	})
+}
+
+// filter returns the observations of the candidates, control excluded, for
+// which fnc returns true.
+func (r *MappedResult[C, D]) filter(fnc func(Observation[D]) bool) []Observation[D] {
+	var observations []Observation[D]
+	for _, o := range r.Observations() {
+		if o.Name != "control" && fnc(o) {
+			observations = append(observations, o)
+		}
+	}
+
+	return observations
+}
+
+func (r *MappedResult[C, D]) finished() bool {
+	if r.execution == nil {
+		return false
+	}
+
+	select {
+	case <-r.execution.done:
+		return true
+	default:
+		return false
+	}
+}
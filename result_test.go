@@ -0,0 +1,68 @@
+package experiment_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestResult(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("it should hold the outcome of all candidates", func(t *testing.T) {
+		exp, _ := testExperiment(experiment.WithConcurrency())
+		res := exp.RunWithResult(ctx)
+		if err := res.Wait(ctx); err != nil {
+			t.Fatalf("Expected no error waiting, got %s", err)
+		}
+
+		if res.Value != "control" || res.Error != nil {
+			t.Errorf("Expected the control outcome, got '%s' and %v", res.Value, res.Error)
+		}
+
+		if !res.Sampled {
+			t.Errorf("Expected the run to be sampled")
+		}
+
+		if len(res.Observations()) != 5 {
+			t.Errorf("Expected 5 observations, got %d", len(res.Observations()))
+		}
+
+		mismatched := res.Mismatched()
+		if len(mismatched) != 1 || mismatched[0].Name != "mismatch" {
+			t.Errorf("Expected the mismatch candidate to mismatch, got %+v", mismatched)
+		}
+
+		failed := res.Failed()
+		if len(failed) != 2 || failed[0].Name != "error" || failed[1].Name != "panic" {
+			t.Errorf("Expected the error and panic candidates to fail, got %+v", failed)
+		}
+
+		if o, ok := res.Candidate("correct"); !ok || !o.Success {
+			t.Errorf("Expected the correct candidate to succeed, got %+v", o)
+		}
+
+		if _, ok := res.Candidate("unknown"); ok {
+			t.Errorf("Expected no observation for an unknown candidate")
+		}
+	})
+
+	t.Run("it should be empty when not sampled", func(t *testing.T) {
+		exp, _ := testExperiment()
+		exp.Ignore(true)
+
+		res := exp.RunWithResult(ctx)
+		if res.Sampled {
+			t.Errorf("Expected the run not to be sampled")
+		}
+
+		if res.Value != "control" {
+			t.Errorf("Expected value 'control', got '%s'", res.Value)
+		}
+
+		if len(res.Observations()) != 0 || len(res.Failed()) != 0 {
+			t.Errorf("Expected no observations")
+		}
+	})
+}
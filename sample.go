@@ -0,0 +1,179 @@
+package experiment
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+// ErrInvalidPercentage is returned when a percentage is not between 0 and 100.
+var ErrInvalidPercentage = errors.New("experiment: percentage must be between 0 and 100")
+
+// Sampler decides whether the candidates of an experiment should run. It is
+// consulted on every run, which allows the decision to change at runtime.
+type Sampler interface {
+	Sample(ctx context.Context, name string) bool
+}
+
+// SamplerFunc is an adapter to use an ordinary function as a Sampler.
+type SamplerFunc func(ctx context.Context, name string) bool
+
+// Sample calls f(ctx, name).
+func (f SamplerFunc) Sample(ctx context.Context, name string) bool {
+	return f(ctx, name)
+}
+
+// PercentageSampler samples a fixed percentage of the runs. The percentage can
+// be fractional, like 0.05 to sample one in every 2000 runs.
+// The percentage must be between 0 and 100. WithSampler, WithServeCandidate,
+// AllOf and AnyOf panic when given one which isn't.
+type PercentageSampler float64
+
+// NewPercentageSampler returns a PercentageSampler which samples the given
+// percentage of the runs. It panics if the percentage is not between 0 and 100.
+func NewPercentageSampler(percentage float64) PercentageSampler {
+	if err := validatePercentage(percentage); err != nil {
+		panic(err)
+	}
+
+	return PercentageSampler(percentage)
+}
+
+// Sample randomly decides whether to run, according to the percentage.
+func (p PercentageSampler) Sample(context.Context, string) bool {
+	return samplePercentage(float64(p))
+}
+
+// NewDynamicSampler returns a new DynamicSampler which samples the given
+// percentage of the runs. It panics if the percentage is not between 0 and 100.
+func NewDynamicSampler(percentage float64) *DynamicSampler {
+	s := &DynamicSampler{}
+	if err := s.Set(percentage); err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// DynamicSampler samples a percentage of the runs which can be changed at
+// runtime, for example by a feature flag system. It is safe for concurrent use.
+type DynamicSampler struct {
+	percentage atomic.Uint64
+}
+
+// Set changes the percentage of runs that are sampled. It returns an
+// ErrInvalidPercentage and keeps the current percentage if the percentage is
+// not between 0 and 100.
+func (s *DynamicSampler) Set(percentage float64) error {
+	if err := validatePercentage(percentage); err != nil {
+		return err
+	}
+
+	s.percentage.Store(math.Float64bits(percentage))
+	return nil
+}
+
+// Percentage returns the current percentage of runs that are sampled.
+func (s *DynamicSampler) Percentage() float64 {
+	return math.Float64frombits(s.percentage.Load())
+}
+
+// Sample randomly decides whether to run, according to the current percentage.
+func (s *DynamicSampler) Sample(context.Context, string) bool {
+	return samplePercentage(s.Percentage())
+}
+
+// AllOf returns a Sampler which only runs when all samplers decide to run.
+// The samplers are consulted in order until one decides not to run. It panics
+// on an invalid PercentageSampler.
+func AllOf(samplers ...Sampler) Sampler {
+	mustValidateSampler(samplers...)
+
+	return SamplerFunc(func(ctx context.Context, name string) bool {
+		for _, s := range samplers {
+			if !s.Sample(ctx, name) {
+				return false
+			}
+		}
+
+		return true
+	})
+}
+
+// AnyOf returns a Sampler which runs when any of the samplers decides to run.
+// The samplers are consulted in order until one decides to run. It panics on an
+// invalid PercentageSampler.
+func AnyOf(samplers ...Sampler) Sampler {
+	mustValidateSampler(samplers...)
+
+	return SamplerFunc(func(ctx context.Context, name string) bool {
+		for _, s := range samplers {
+			if s.Sample(ctx, name) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// sample decides whether the candidates should run according to the configured
+// percentage. With a sample key, the decision is the same for every run with
+// that key and salt. The key of a run takes precedence over the configured one.
+func (c *Config) sample(key *string) bool {
+	if key == nil {
+		key = c.SampleKey
+	}
+
+	if key == nil {
+		return samplePercentage(c.Percentage)
+	}
+
+	salt := c.Salt
+	if salt == "" {
+		salt = c.Name
+	}
+
+	return bucket(salt, *key) < c.Percentage
+}
+
+func samplePercentage(p float64) bool {
+	return rand.Float64()*100 < p
+}
+
+// bucket hashes the key together with the salt into a bucket between 0 and
+// 100.
+func bucket(salt, key string) float64 {
+	h := sha256.New()
+	h.Write([]byte(salt))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+
+	// use the top 53 bits, which is the precision of a float64.
+	return float64(binary.BigEndian.Uint64(h.Sum(nil))>>11) / (1 << 53) * 100
+}
+
+// mustValidateSampler panics if any of the samplers is a PercentageSampler which
+// is not between 0 and 100.
+func mustValidateSampler(samplers ...Sampler) {
+	for _, s := range samplers {
+		if p, ok := s.(PercentageSampler); ok {
+			if err := validatePercentage(float64(p)); err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+func validatePercentage(p float64) error {
+	if !(p >= 0 && p <= 100) {
+		return fmt.Errorf("%w, got %v", ErrInvalidPercentage, p)
+	}
+
+	return nil
+}
@@ -0,0 +1,218 @@
+package experiment_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/jelmersnoeck/experiment/v3"
+)
+
+func TestSampleKey(t *testing.T) {
+	t.Run("it should make the same decision for the same key", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			key := fmt.Sprintf("user-%d", i)
+			expected := sampled(experiment.WithPercentage(50), experiment.WithSampleKey(key))
+
+			for j := 0; j < 10; j++ {
+				if sampled(experiment.WithPercentage(50), experiment.WithSampleKey(key)) != expected {
+					t.Fatalf("Expected key '%s' to be sampled consistently", key)
+				}
+			}
+		}
+	})
+
+	t.Run("it should sample the configured percentage of keys", func(t *testing.T) {
+		var count int
+		for i := 0; i < 10000; i++ {
+			if sampled(experiment.WithPercentage(30), experiment.WithSampleKey(fmt.Sprintf("user-%d", i))) {
+				count++
+			}
+		}
+
+		if count < 2800 || count > 3200 {
+			t.Errorf("Expected about 3000 sampled keys, got %d", count)
+		}
+	})
+
+	t.Run("it should not correlate experiments with a different salt", func(t *testing.T) {
+		var both int
+		for i := 0; i < 10000; i++ {
+			key := experiment.WithSampleKey(fmt.Sprintf("user-%d", i))
+			first := sampled(experiment.WithPercentage(30), key, experiment.WithSalt("first"))
+			second := sampled(experiment.WithPercentage(30), key, experiment.WithSalt("second"))
+			if first && second {
+				both++
+			}
+		}
+
+		// with independent experiments, 30% of 30% of the keys are in both.
+		if both < 700 || both > 1100 {
+			t.Errorf("Expected about 900 keys in both experiments, got %d", both)
+		}
+	})
+
+	t.Run("it should sample fractional percentages", func(t *testing.T) {
+		var count int
+		for i := 0; i < 20000; i++ {
+			if sampled(experiment.WithFractionalPercentage(1.5), experiment.WithSampleKey(fmt.Sprintf("user-%d", i))) {
+				count++
+			}
+		}
+
+		if count < 240 || count > 360 {
+			t.Errorf("Expected about 300 sampled keys, got %d", count)
+		}
+	})
+
+	t.Run("it should respect the bounds", func(t *testing.T) {
+		for i := 0; i < 100; i++ {
+			key := experiment.WithSampleKey(fmt.Sprintf("user-%d", i))
+			if sampled(experiment.WithPercentage(0), key) {
+				t.Errorf("Expected no keys to be sampled at 0%%")
+			}
+
+			if !sampled(experiment.WithPercentage(100), key) {
+				t.Errorf("Expected all keys to be sampled at 100%%")
+			}
+		}
+	})
+}
+
+// sampled reports whether the candidates of an experiment with the given
+// configuration ran.
+func sampled(cfg ...experiment.ConfigFunc) bool {
+	exp := experiment.New[string](cfg...)
+
+	var ran bool
+	exp.Control(func(context.Context) (string, error) {
+		return "", nil
+	})
+
+	exp.Candidate("candidate", func(context.Context) (string, error) {
+		ran = true
+		return "", nil
+	})
+
+	exp.Run(context.Background())
+	return ran
+}
+
+func TestSampler(t *testing.T) {
+	always := experiment.SamplerFunc(func(context.Context, string) bool { return true })
+	never := experiment.SamplerFunc(func(context.Context, string) bool { return false })
+
+	t.Run("it should pass the experiment name", func(t *testing.T) {
+		var name string
+		sampler := experiment.SamplerFunc(func(_ context.Context, n string) bool {
+			name = n
+			return true
+		})
+
+		if !sampled(experiment.WithName("renderer"), experiment.WithSampler(sampler)) {
+			t.Errorf("Expected the experiment to be sampled")
+		}
+
+		if name != "renderer" {
+			t.Errorf("Expected name 'renderer', got '%s'", name)
+		}
+	})
+
+	t.Run("it should take precedence over the percentage", func(t *testing.T) {
+		if sampled(experiment.WithPercentage(100), experiment.WithSampler(never)) {
+			t.Errorf("Expected the sampler to decide not to run")
+		}
+	})
+
+	t.Run("it should be overruled by Force", func(t *testing.T) {
+		exp := experiment.New[string](experiment.WithSampler(never))
+		exp.Force(true)
+
+		var ran bool
+		exp.Control(func(context.Context) (string, error) {
+			return "", nil
+		})
+		exp.Candidate("candidate", func(context.Context) (string, error) {
+			ran = true
+			return "", nil
+		})
+
+		exp.Run(context.Background())
+		if !ran {
+			t.Errorf("Expected the candidate to run")
+		}
+	})
+
+	t.Run("it should change the dynamic percentage at runtime", func(t *testing.T) {
+		sampler := experiment.NewDynamicSampler(0)
+		if sampled(experiment.WithSampler(sampler)) {
+			t.Errorf("Expected no run at 0%%")
+		}
+
+		sampler.Set(100)
+		if !sampled(experiment.WithSampler(sampler)) {
+			t.Errorf("Expected a run at 100%%")
+		}
+
+		if p := sampler.Percentage(); p != 100 {
+			t.Errorf("Expected percentage 100, got %v", p)
+		}
+	})
+
+	t.Run("it should reject invalid percentages", func(t *testing.T) {
+		sampler := experiment.NewDynamicSampler(10)
+		for _, p := range []float64{-1, 100.5, math.NaN()} {
+			if err := sampler.Set(p); !errors.Is(err, experiment.ErrInvalidPercentage) {
+				t.Errorf("Expected ErrInvalidPercentage for %v, got %v", p, err)
+			}
+		}
+
+		if p := sampler.Percentage(); p != 10 {
+			t.Errorf("Expected percentage to remain 10, got %v", p)
+		}
+
+		for name, fnc := range map[string]func(){
+			"WithFractionalPercentage": func() { experiment.WithFractionalPercentage(101) },
+			"WithPercentage above 100": func() { experiment.WithPercentage(150) },
+			"WithPercentage below 0":   func() { experiment.WithPercentage(-5) },
+			"NewPercentageSampler":     func() { experiment.NewPercentageSampler(100.5) },
+			"WithSampler":              func() { experiment.WithSampler(experiment.PercentageSampler(-1)) },
+			"WithServeCandidate":       func() { experiment.WithServeCandidate("c", experiment.PercentageSampler(101)) },
+			"AllOf":                    func() { experiment.AllOf(experiment.PercentageSampler(math.NaN())) },
+			"AnyOf":                    func() { experiment.AnyOf(experiment.PercentageSampler(200)) },
+		} {
+			func() {
+				defer func() {
+					err, _ := recover().(error)
+					if !errors.Is(err, experiment.ErrInvalidPercentage) {
+						t.Errorf("Expected %s to panic with ErrInvalidPercentage, got %v", name, err)
+					}
+				}()
+
+				fnc()
+			}()
+		}
+	})
+
+	t.Run("it should combine samplers", func(t *testing.T) {
+		tcs := map[string]struct {
+			sampler  experiment.Sampler
+			expected bool
+		}{
+			"all of with all running":  {experiment.AllOf(always, experiment.PercentageSampler(100)), true},
+			"all of with one skipping": {experiment.AllOf(always, never), false},
+			"any of with one running":  {experiment.AnyOf(never, always), true},
+			"any of with none running": {experiment.AnyOf(never, experiment.PercentageSampler(0)), false},
+		}
+
+		for name, tc := range tcs {
+			t.Run(name, func(t *testing.T) {
+				if actual := tc.sampler.Sample(context.Background(), ""); actual != tc.expected {
+					t.Errorf("Expected %t, got %t", tc.expected, actual)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,42 @@
+package experiment
+
+import (
+	"bytes"
+	"runtime/debug"
+)
+
+var newline = []byte("\n")
+
+// panicStack returns the stack of the current goroutine, starting at the frame
+// that panicked. It must be called from the deferred function that recovered
+// the panic.
+func panicStack() []byte {
+	stack := debug.Stack()
+	lines := bytes.Split(stack, newline)
+
+	// the first line is the goroutine header, after which every frame takes
+	// up two lines: the function and its location.
+	for i := 1; i+1 < len(lines); i += 2 {
+		if bytes.HasPrefix(lines[i], []byte("panic(")) {
+			return bytes.Join(append(lines[:1:1], lines[i+2:]...), newline)
+		}
+	}
+
+	return stack
+}
+
+// TrimStack trims a stack as recorded on a CandidatePanicError or
+// ControlPanicError to the given amount of frames. A depth of zero or less
+// returns the full stack.
+func TrimStack(stack []byte, depth int) []byte {
+	if depth <= 0 {
+		return stack
+	}
+
+	lines := bytes.Split(bytes.TrimRight(stack, "\n"), newline)
+	if keep := 1 + 2*depth; keep < len(lines) {
+		lines = lines[:keep]
+	}
+
+	return bytes.Join(lines, newline)
+}